@@ -15,22 +15,50 @@ import (
 	"github.com/wanyuqin/lux/extractors/facebook"
 	"github.com/wanyuqin/lux/extractors/twitter"
 	"github.com/wanyuqin/lux/extractors/youtube"
+	"github.com/wanyuqin/tool-collection/backend/pool"
 	"github.com/wanyuqin/tool-collection/backend/tools"
 	"github.com/wanyuqin/tool-collection/backend/x/xfile"
 	"github.com/wanyuqin/tool-collection/configs"
 	"github.com/wanyuqin/tool-collection/logger"
+	"io/fs"
 	"os"
 	"path/filepath"
+	goruntime "runtime"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	DownloadDoneEvent = "download.done"
+	// 下载队列变化 发送队列快照
+	DownloadQueueEvent = "download.queue.change"
+
+	TransformSuccessEvent = "ncm.transform.success"
+	TransformFailedEvent  = "ncm.transform.failed"
+	TransformDoneEvent    = "ncm.transform.done"
+	// 解密进度 {file, done, total}
+	TransformProgressEvent = "ncm.transform.progress"
+
+	NcmScanBatchEvent = "ncm.scan.batch"
+	NcmScanDoneEvent  = "ncm.scan.done"
+
+	// 监听文件夹中的文件转换完成 成功或失败都会发送
+	WatchConvertedEvent = "ncm.watch.converted"
 )
 
 // App struct
 type App struct {
 	ctx context.Context
+
+	// 取消正在进行的批量转换 每个批次一个
+	transformMux     sync.Mutex
+	transformBatch   int
+	transformCancels map[int]context.CancelFunc
+
+	// 停止监听文件夹
+	watchMux    sync.Mutex
+	watchCancel context.CancelFunc
 }
 
 // NewApp creates a new App application struct
@@ -52,6 +80,17 @@ func (a *App) startup(ctx context.Context) {
 
 	a.initFolder()
 
+	scheduler := tools.GetDownloadScheduler()
+	scheduler.SetMaxActive(configs.GetConfig().Download.MaxActive)
+	scheduler.OnChange = func(items []tools.DownloadQueueItem) {
+		runtime.EventsEmit(a.ctx, DownloadQueueEvent, items)
+	}
+
+	if configs.GetConfig().Ncm.Watch.Enabled {
+		if err := a.StartWatch(); err != nil {
+			logger.Errorf("Start watch failed: %v", err)
+		}
+	}
 }
 
 // 初始化文件夹 保存配置文件 以及历史记录 以及日志
@@ -87,10 +126,10 @@ func (a *App) initFolder() {
 func (a *App) beforeClose(ctx context.Context) bool {
 
 	dl := tools.GetDownloadList()
-	if dl.Length() > 0 {
+	if dl.Length() > 0 || len(tools.GetDownloadScheduler().Snapshot()) > 0 {
 		md, err := runtime.MessageDialog(ctx, runtime.MessageDialogOptions{
 			Title:         "关闭",
-			Message:       "还有未完成的下载，是否退出",
+			Message:       "还有未完成的下载，下次启动时可以继续下载，是否退出",
 			Type:          runtime.QuestionDialog,
 			Buttons:       []string{"Yes", "No"},
 			DefaultButton: "Yes",
@@ -114,45 +153,309 @@ func (a *App) Greet(name string) string {
 	return fmt.Sprintf("Hello %s, It's show time!", name)
 }
 
-func (a *App) SelectDirectory() ([]NcmFile, error) {
+// SelectDirectory 选择文件夹并扫描加密音乐 options.BatchSize 大于0时通过事件分批返回
+func (a *App) SelectDirectory(options tools.ScanOptions) ([]NcmFile, error) {
 	dialog, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{})
 	if err != nil {
 		fmt.Printf(err.Error())
 		return nil, err
 	}
+	// 取消选择
+	if dialog == "" {
+		return nil, nil
+	}
 
-	ncmList, err := FindNcmList(dialog)
+	if options.BatchSize > 0 {
+		return nil, a.streamNcmList(dialog, options)
+	}
+
+	ncmList, err := FindNcmList(dialog, options)
 	return ncmList, err
 }
 
-func (a *App) Transform(files []NcmFile) {
-	if len(files) <= 0 {
-		return
+// streamNcmList 扫描结果分批发送给前端
+func (a *App) streamNcmList(dirPath string, options tools.ScanOptions) error {
+	total := 0
+	batch := make([]NcmFile, 0, options.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		runtime.EventsEmit(a.ctx, NcmScanBatchEvent, batch)
+		total += len(batch)
+		batch = make([]NcmFile, 0, options.BatchSize)
+	}
+
+	err := tools.ScanMusicFiles(a.ctx, dirPath, options, func(path string, info fs.FileInfo) error {
+		batch = append(batch, newNcmFile(path, info, options.Inspect))
+		if len(batch) >= options.BatchSize {
+			flush()
+		}
+		return nil
+	})
+	flush()
+
+	runtime.EventsEmit(a.ctx, NcmScanDoneEvent, map[string]interface{}{
+		"dir":   dirPath,
+		"total": total,
+	})
+	return err
+}
+
+// Transform 批量转换 每个文件完成后发送成功或失败事件 全部完成后返回汇总
+// 转换过程中发送进度事件 可以通过 CancelTransform 取消
+func (a *App) Transform(files []NcmFile) tools.TransformSummary {
+	start := time.Now()
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.transformMux.Lock()
+	a.transformBatch++
+	batch := a.transformBatch
+	if a.transformCancels == nil {
+		a.transformCancels = make(map[int]context.CancelFunc)
+	}
+	a.transformCancels[batch] = cancel
+	a.transformMux.Unlock()
+	defer func() {
+		a.transformMux.Lock()
+		delete(a.transformCancels, batch)
+		a.transformMux.Unlock()
+		cancel()
+	}()
+
+	cfg := configs.GetConfig().Ncm
+	options := tools.NewTransformOptions(cfg)
+	options.Progress = func(progress tools.TransformProgress) {
+		runtime.EventsEmit(a.ctx, TransformProgressEvent, progress)
 	}
-	wg := &sync.WaitGroup{}
+	p := pool.New[tools.TransformResult](ctx, transformWorkers(cfg))
 	for i := range files {
-		if isNcm(files[i].Path) {
-			wg.Add(1)
-			go func(wg *sync.WaitGroup, file NcmFile) {
-				tools.ProcessNcmFile(a.ctx, file.Path)
-				logger.Debug(fmt.Sprintf("ncm transform %s done", file.Name))
-				runtime.EventsEmit(a.ctx, "ncm.transform.done", file.Name)
-				defer wg.Done()
-			}(wg, files[i])
+		file := files[i]
+		p.Submit(func(ctx context.Context) (tools.TransformResult, error) {
+			result := tools.TransformResult{Input: file.Path}
+			if tools.IsEncryptedMusic(file.Path) {
+				result = tools.ProcessMusicFile(ctx, file.Path, options)
+			} else {
+				result.Err = tools.UnsupportedFormatErr
+				result.Error = result.Err.Error()
+			}
+			a.emitTransformResult(file, result)
+			return result, result.Err
+		})
+	}
+
+	results := make([]tools.TransformResult, 0, len(files))
+	for _, r := range p.Wait() {
+		result := r.Value
+		// 任务panic或未执行时没有结果
+		if result.Input == "" {
+			result = tools.TransformResult{Input: files[r.Index].Path, Err: r.Err, Error: r.Err.Error()}
+			a.emitTransformResult(files[r.Index], result)
+		}
+		results = append(results, result)
+	}
+
+	summary := tools.NewTransformSummary(results, time.Since(start))
+	runtime.EventsEmit(a.ctx, TransformDoneEvent, summary)
+	return summary
+}
+
+// InspectNcm 只读取NCM文件头 返回歌曲信息和封面缩略图
+func (a *App) InspectNcm(path string) (*tools.NcmInfo, error) {
+	return tools.InspectNcm(path)
+}
+
+// CancelTransform 取消所有正在进行的批量转换 已输出的部分文件会被删除
+func (a *App) CancelTransform() {
+	a.transformMux.Lock()
+	defer a.transformMux.Unlock()
+	for _, cancel := range a.transformCancels {
+		cancel()
+	}
+}
+
+// ListArchivedSources 转换后归档的源文件
+func (a *App) ListArchivedSources() ([]tools.ArchiveEntry, error) {
+	return tools.NewSourceArchive("").List()
+}
+
+// RestoreSource 把归档的源文件移回原来的位置 返回恢复后的路径
+func (a *App) RestoreSource(id string) (string, error) {
+	return tools.NewSourceArchive("").Restore(id)
+}
+
+// SelectOrganizeDirectory 选择要整理的文件夹 返回整理预览 取消选择时返回nil
+func (a *App) SelectOrganizeDirectory(options tools.ScanOptions) (*tools.OrganizePlan, error) {
+	dialog, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{})
+	if err != nil || dialog == "" {
+		return nil, err
+	}
+	return a.PlanOrganize(dialog, options)
+}
+
+// PlanOrganize 按标签生成 Artist/Album/NN Title.ext 的整理预览 不会移动文件
+func (a *App) PlanOrganize(dir string, options tools.ScanOptions) (*tools.OrganizePlan, error) {
+	return tools.PlanOrganize(a.ctx, dir, options)
+}
+
+// ApplyOrganize 执行整理预览中没有冲突的移动 返回的 BatchID 用于撤销
+func (a *App) ApplyOrganize(plan tools.OrganizePlan) (tools.OrganizeResult, error) {
+	return tools.ApplyOrganize(a.ctx, &plan, tools.NewOrganizeJournal(""))
+}
+
+// ListOrganizeHistory 可以撤销的整理记录
+func (a *App) ListOrganizeHistory() ([]tools.OrganizeBatchInfo, error) {
+	return tools.NewOrganizeJournal("").List()
+}
+
+// UndoOrganize 撤销一次整理 返回恢复的文件数
+func (a *App) UndoOrganize(id string) (int, error) {
+	return tools.NewOrganizeJournal("").Undo(id)
+}
+
+// SelectTagFiles 选择多个mp3或flac文件并读取标签 取消选择时返回nil
+func (a *App) SelectTagFiles() ([]tools.TagFile, error) {
+	paths, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Filters: []runtime.FileFilter{{DisplayName: "Audio (*.mp3;*.flac)", Pattern: "*.mp3;*.flac"}},
+	})
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	return tools.ReadTagFiles(paths), nil
+}
+
+// SelectCoverImage 选择封面图片 返回图片路径
+func (a *App) SelectCoverImage() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Filters: []runtime.FileFilter{{DisplayName: "Image (*.jpg;*.jpeg;*.png)", Pattern: "*.jpg;*.jpeg;*.png"}},
+	})
+}
+
+// ReadTags 读取多个文件的标签 读取失败的文件设置 error
+func (a *App) ReadTags(paths []string) []tools.TagFile {
+	return tools.ReadTagFiles(paths)
+}
+
+// PreviewTagEdits 按顺序应用批量编辑 返回修改后的标签 不会写入文件
+func (a *App) PreviewTagEdits(files []tools.TagFile, edits []tools.TagEdit) ([]tools.TagFile, error) {
+	return tools.ApplyTagEdits(files, edits)
+}
+
+// WriteTags 写入标签 返回重新读取的标签 写入失败的文件设置 error
+func (a *App) WriteTags(files []tools.TagFile) []tools.TagFile {
+	return tools.WriteTagFiles(files)
+}
+
+// transformWorkers 同时转换的文件数
+func transformWorkers(cfg configs.NcmConfig) int {
+	if cfg.Workers <= 0 {
+		return goruntime.NumCPU()
+	}
+	return cfg.Workers
+}
+
+// StartWatch 按配置监听文件夹 新增的加密音乐写完后自动转换 已在监听时重新启动
+func (a *App) StartWatch() error {
+	a.StopWatch()
+
+	cfg := configs.GetConfig().Ncm
+	if len(cfg.Watch.Dirs) == 0 {
+		return tools.WatchNoDirErr
+	}
+	journal, err := tools.OpenWatchJournal("")
+	if err != nil {
+		return err
+	}
+	options := tools.NewWatchOptions(cfg.Watch)
+	options.Workers = transformWorkers(cfg)
+	transformOptions := tools.NewTransformOptions(cfg)
+	watcher := tools.NewWatcher(options, journal, func(ctx context.Context, path string) tools.TransformResult {
+		result := tools.ProcessMusicFile(ctx, path, transformOptions)
+		if errors.Is(result.Err, context.Canceled) {
+			return result
+		}
+		if result.Success() {
+			logger.Debug(fmt.Sprintf("watch transform %s done", path))
+		} else {
+			logger.Error(fmt.Sprintf("watch transform %s failed: %v", path, result.Err))
+		}
+		runtime.EventsEmit(a.ctx, WatchConvertedEvent, result)
+		return result
+	})
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.watchMux.Lock()
+	a.watchCancel = cancel
+	a.watchMux.Unlock()
+	go func() {
+		if err := watcher.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error(fmt.Sprintf("watch stopped: %v", err))
+		}
+	}()
+	return nil
+}
+
+// StopWatch 停止监听文件夹 正在转换的文件会被取消
+func (a *App) StopWatch() {
+	a.watchMux.Lock()
+	defer a.watchMux.Unlock()
+	if a.watchCancel != nil {
+		a.watchCancel()
+		a.watchCancel = nil
+	}
+}
+
+// AddWatchDirectory 选择文件夹加入监听列表 保存设置并开始监听
+func (a *App) AddWatchDirectory() (configs.WatchConfig, error) {
+	cfg := configs.GetConfig().Ncm
+	dialog, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{})
+	if err != nil || dialog == "" {
+		return cfg.Watch, err
+	}
+	for _, dir := range cfg.Watch.Dirs {
+		if dir == dialog {
+			dialog = ""
+			break
 		}
 	}
-	wg.Wait()
+	if dialog != "" {
+		cfg.Watch.Dirs = append(cfg.Watch.Dirs, dialog)
+	}
+	cfg.Watch.Enabled = true
+	return cfg.Watch, a.SaveNcmSettings(cfg)
+}
+
+func (a *App) emitTransformResult(file NcmFile, result tools.TransformResult) {
+	// 取消的文件只在汇总中体现
+	if errors.Is(result.Err, context.Canceled) {
+		logger.Debug(fmt.Sprintf("ncm transform %s canceled", file.Name))
+		return
+	}
+	if !result.Success() {
+		logger.Error(fmt.Sprintf("ncm transform %s failed: %v", file.Name, result.Err))
+		runtime.EventsEmit(a.ctx, TransformFailedEvent, result)
+		return
+	}
+	logger.Debug(fmt.Sprintf("ncm transform %s done", file.Name))
+	runtime.EventsEmit(a.ctx, TransformSuccessEvent, result)
 }
 
 func (a *App) ExtractLink(link string) ([]tools.ExtractLinkData, error) {
 	return tools.ExtractLink(link)
 }
 
-// Download 下载
+// Download 下载 data.Stream 为选择的清晰度 为空时按设置选择
 func (a *App) Download(data tools.ExtractLinkData) error {
 	logger.Debug(fmt.Sprintf("ctx is %d", &a.ctx))
 
-	err := tools.Download(a.ctx, data)
+	err := tools.EnqueueDownload(a.ctx, data)
+	if errors.Is(err, context.Canceled) {
+		logger.Debug(fmt.Sprintf("download %s canceled", data.Title))
+		return nil
+	}
+	if errors.Is(err, tools.DownloadPausedErr) {
+		logger.Debug(fmt.Sprintf("download %s paused", data.Title))
+		return nil
+	}
 	if err != nil && !errors.Is(err, tools.FileExistErr) {
 		logger.Error(fmt.Sprintf("download %s failed %v", data.Title, err))
 		return err
@@ -177,6 +480,21 @@ func (a *App) CancelDownload(id string) {
 	tools.CancelDownload(id)
 }
 
+// PauseDownload 暂停下载 保留已下载的分片
+func (a *App) PauseDownload(id string) error {
+	return tools.PauseDownload(a.ctx, id)
+}
+
+// ResumeDownload 继续暂停的下载 从已下载的位置开始 下载结束后返回
+func (a *App) ResumeDownload(id string) error {
+	data, err := tools.ResumeDownload(id)
+	if err != nil {
+		logger.Error(fmt.Sprintf("resume download %s failed %v", id, err))
+		return err
+	}
+	return a.Download(data)
+}
+
 // GetDownloadSettings 获取下载设置
 func (a *App) GetDownloadSettings() configs.DownloadConfig {
 	// 加载配置文件
@@ -186,12 +504,85 @@ func (a *App) GetDownloadSettings() configs.DownloadConfig {
 
 func (a *App) SaveDownloadSettings(config configs.DownloadConfig) error {
 	logger.Debug(fmt.Sprintf("%v", config))
-	return configs.SaveDownloadSettings(config)
+	if err := configs.SaveDownloadSettings(config); err != nil {
+		return err
+	}
+	tools.GetDownloadScheduler().SetMaxActive(config.MaxActive)
+	return nil
 }
 
-// DownloadHistory 查找历史记录
-func (a *App) DownloadHistory() {
+// GetQueue 下载队列快照 下载中的在前 等待中的按下载顺序在后
+func (a *App) GetQueue() []tools.DownloadQueueItem {
+	return tools.GetDownloadScheduler().Snapshot()
+}
+
+// SetDownloadPriority 修改等待中的下载的优先级 越大越先下载
+func (a *App) SetDownloadPriority(id string, priority int) error {
+	return tools.GetDownloadScheduler().SetPriority(id, priority)
+}
+
+// MoveDownloadUp 等待中的下载上移一位
+func (a *App) MoveDownloadUp(id string) error {
+	return tools.GetDownloadScheduler().MoveUp(id)
+}
 
+// MoveDownloadDown 等待中的下载下移一位
+func (a *App) MoveDownloadDown(id string) error {
+	return tools.GetDownloadScheduler().MoveDown(id)
+}
+
+// GetNcmSettings 获取音乐解密设置
+func (a *App) GetNcmSettings() configs.NcmConfig {
+	config := configs.LoadConfig()
+	return config.Ncm
+}
+
+// SaveNcmSettings 保存音乐解密设置 按新的设置启动或停止监听文件夹
+func (a *App) SaveNcmSettings(config configs.NcmConfig) error {
+	logger.Debug(fmt.Sprintf("%v", config))
+	if err := configs.SaveNcmSettings(config); err != nil {
+		return err
+	}
+	if !config.Watch.Enabled {
+		a.StopWatch()
+		return nil
+	}
+	return a.StartWatch()
+}
+
+// DownloadHistory 按标题 网站 状态和时间分页查找下载记录
+func (a *App) DownloadHistory(query tools.DownloadHistoryQuery) tools.DownloadHistoryPage {
+	return tools.GetDownloadHistory().List(query)
+}
+
+// DeleteDownloadHistory 删除下载记录 不删除下载的文件
+func (a *App) DeleteDownloadHistory(ids []string) error {
+	return tools.GetDownloadHistory().Delete(ids...)
+}
+
+// ClearDownloadHistory 清空下载记录 正在下载的记录保留
+func (a *App) ClearDownloadHistory() error {
+	return tools.GetDownloadHistory().Clear()
+}
+
+// UnfinishedDownloads 上次退出时没有完成的下载
+func (a *App) UnfinishedDownloads() []tools.DownloadTask {
+	return tools.UnfinishedDownloads()
+}
+
+// ResumeDownloads 重新解析未完成的下载 返回的数据调用 Download 继续下载
+func (a *App) ResumeDownloads(ids []string) ([]tools.ExtractLinkData, error) {
+	return tools.ResumeDownloads(ids)
+}
+
+// DiscardDownloads 放弃未完成的下载 删除已下载的分片
+func (a *App) DiscardDownloads(ids []string) error {
+	return tools.DiscardDownloads(ids)
+}
+
+// Redownload 重新解析下载记录的地址 返回的数据可以直接调用 Download
+func (a *App) Redownload(id string) ([]tools.ExtractLinkData, error) {
+	return tools.ExtractHistoryLink(id)
 }
 
 type NcmFile struct {
@@ -199,43 +590,56 @@ type NcmFile struct {
 	Path    string `json:"path"`
 	ModTime string `json:"mod_time"`
 	Size    string `json:"size"`
+
+	// 以下字段只在扫描时指定 inspect 并且是NCM文件时返回
+	Title    string   `json:"title,omitempty"`
+	Artists  []string `json:"artists,omitempty"`
+	Album    string   `json:"album,omitempty"`
+	Format   string   `json:"format,omitempty"`
+	BitRate  int      `json:"bitrate,omitempty"`
+	Duration int      `json:"duration,omitempty"`
+	Cover    string   `json:"cover,omitempty"`
 }
 
-func FindNcmList(dirPath string) ([]NcmFile, error) {
-	df, err := os.ReadDir(dirPath)
+func FindNcmList(dirPath string, options tools.ScanOptions) ([]NcmFile, error) {
+	ncmFiles := make([]NcmFile, 0, 0)
+
+	err := tools.ScanMusicFiles(context.Background(), dirPath, options, func(path string, info fs.FileInfo) error {
+		ncmFiles = append(ncmFiles, newNcmFile(path, info, options.Inspect))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	ncmFiles := make([]NcmFile, 0, 0)
-
-	for _, file := range df {
-		if !file.IsDir() && isNcm(file.Name()) {
-
-			info, err := file.Info()
-			if err != nil {
-				logger.Error(err.Error())
-				continue
-			}
+	return ncmFiles, nil
 
-			ncmFile := NcmFile{
-				Name:    file.Name(),
-				Path:    filepath.Join(dirPath, file.Name()),
-				ModTime: info.ModTime().Format("2006-01-02 15:04:05"),
-				Size:    humanize.Bytes(uint64(info.Size())),
-			}
+}
 
-			ncmFiles = append(ncmFiles, ncmFile)
-		}
+func newNcmFile(path string, info fs.FileInfo, inspect bool) NcmFile {
+	file := NcmFile{
+		Name:    info.Name(),
+		Path:    path,
+		ModTime: info.ModTime().Format("2006-01-02 15:04:05"),
+		Size:    humanize.Bytes(uint64(info.Size())),
+	}
+	if !inspect || !strings.EqualFold(filepath.Ext(path), ".ncm") {
+		return file
 	}
 
-	return ncmFiles, err
-
-}
-
-// 判断NCM
-func isNcm(name string) bool {
-	return filepath.Ext(name) == ".ncm"
+	ncmInfo, err := tools.InspectNcm(path)
+	if err != nil {
+		logger.Error(fmt.Sprintf("inspect %s failed: %v", path, err))
+		return file
+	}
+	file.Title = ncmInfo.Title
+	file.Artists = ncmInfo.Artists
+	file.Album = ncmInfo.Album
+	file.Format = ncmInfo.Format
+	file.BitRate = ncmInfo.BitRate
+	file.Duration = ncmInfo.Duration
+	file.Cover = ncmInfo.Cover
+	return file
 }
 
 // 加载下载器
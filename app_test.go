@@ -1,22 +1,51 @@
 package main
 
 import (
-	"fmt"
+	"bytes"
 	"github.com/wanyuqin/lux/downloader"
 	"github.com/wanyuqin/lux/extractors"
 	"github.com/wanyuqin/lux/extractors/bilibili"
+	"github.com/wanyuqin/tool-collection/backend/tools"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestFindNcmList(t *testing.T) {
-	list, err := FindNcmList("/Users/ethanleo/GolandProjects/study-go2/go-ncm")
+	dir := t.TempDir()
+	for _, name := range []string{"a.ncm", "b.ncm"} {
+		buf := &bytes.Buffer{}
+		w, err := tools.NewNcmWriter(buf, nil, &tools.MetaInfo{MusicName: name, Format: "mp3"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("fake mp3 audio"))
+		if err = os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c.mp3"), []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := FindNcmList(dir, tools.ScanOptions{})
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "a.ncm" || list[1].Name != "b.ncm" {
+		t.Fatalf("unexpected list %#v", list)
+	}
+	if list[0].Title != "" {
+		t.Fatalf("expected no track info without inspect, got %#v", list[0])
 	}
 
-	for _, item := range list {
-		fmt.Printf("%#v", item)
+	list, err = FindNcmList(dir, tools.ScanOptions{Inspect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Title != "a.ncm" || list[0].Format != "mp3" {
+		t.Fatalf("unexpected list %#v", list)
 	}
 }
 
@@ -1 +1,184 @@
 package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	PoolClosedErr = errors.New("pool is closed")
+	TaskPanicErr  = errors.New("task panicked")
+)
+
+// Task 池中执行的任务 需要自行检查ctx是否已取消
+type Task[T any] func(ctx context.Context) (T, error)
+
+// Result 任务执行结果 Index 为任务提交的顺序
+type Result[T any] struct {
+	Index int
+	Value T
+	Err   error
+}
+
+// Pool 有界协程池 最多同时运行 size 个任务
+type Pool[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	tasks chan indexedTask[T]
+	wg    sync.WaitGroup
+
+	// 保护 closed 提交任务时持有读锁 防止向已关闭的队列发送
+	submitMux sync.RWMutex
+	closed    bool
+
+	mux     sync.Mutex
+	results []Result[T]
+	// 任务失败时取消剩余任务
+	failFast bool
+}
+
+type indexedTask[T any] struct {
+	index int
+	task  Task[T]
+}
+
+// Option 协程池参数
+type Option func(o *options)
+
+type options struct {
+	failFast bool
+}
+
+// WithFailFast 任意任务返回错误时取消池中剩余任务
+func WithFailFast() Option {
+	return func(o *options) {
+		o.failFast = true
+	}
+}
+
+// New 创建协程池 size 小于1时按1处理
+func New[T any](ctx context.Context, size int, opts ...Option) *Pool[T] {
+	if size < 1 {
+		size = 1
+	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pool[T]{
+		ctx:      ctx,
+		cancel:   cancel,
+		tasks:    make(chan indexedTask[T]),
+		failFast: o.failFast,
+	}
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		w := &goWorker[T]{pool: p}
+		go w.run()
+	}
+	return p
+}
+
+// Context 池的ctx 取消后剩余任务不再执行
+func (p *Pool[T]) Context() context.Context {
+	return p.ctx
+}
+
+// Submit 提交任务 所有协程都在忙时阻塞
+// 池已关闭时返回 PoolClosedErr 已取消时返回 ctx 的错误
+func (p *Pool[T]) Submit(task Task[T]) error {
+	p.submitMux.RLock()
+	defer p.submitMux.RUnlock()
+	if p.closed {
+		return PoolClosedErr
+	}
+
+	p.mux.Lock()
+	index := len(p.results)
+	p.results = append(p.results, Result[T]{Index: index})
+	p.mux.Unlock()
+
+	select {
+	case p.tasks <- indexedTask[T]{index: index, task: task}:
+		return nil
+	case <-p.ctx.Done():
+		p.setResult(index, *new(T), p.ctx.Err())
+		return p.ctx.Err()
+	}
+}
+
+// Cancel 取消池中的任务 正在执行的任务通过ctx感知
+func (p *Pool[T]) Cancel() {
+	p.cancel()
+}
+
+// Wait 停止接收任务 等待已提交的任务执行完毕 返回按提交顺序排列的结果
+func (p *Pool[T]) Wait() []Result[T] {
+	p.submitMux.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.submitMux.Unlock()
+
+	p.wg.Wait()
+	p.cancel()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	results := make([]Result[T], len(p.results))
+	copy(results, p.results)
+	return results
+}
+
+// Err 返回第一个失败任务的错误
+func (p *Pool[T]) Err() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, result := range p.results {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+func (p *Pool[T]) execute(t indexedTask[T]) {
+	if err := p.ctx.Err(); err != nil {
+		p.setResult(t.index, *new(T), err)
+		return
+	}
+
+	var (
+		value T
+		err   error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				// 调用栈只记录到日志 错误会显示给用户
+				logger.Error(fmt.Sprintf("task panicked: %v\n%s", r, debug.Stack()))
+				err = fmt.Errorf("%w: %v", TaskPanicErr, r)
+			}
+		}()
+		value, err = t.task(p.ctx)
+	}()
+
+	p.setResult(t.index, value, err)
+	if err != nil && p.failFast {
+		p.cancel()
+	}
+}
+
+func (p *Pool[T]) setResult(index int, value T, err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.results[index] = Result[T]{Index: index, Value: value, Err: err}
+}
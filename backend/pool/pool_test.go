@@ -0,0 +1,102 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"github.com/wanyuqin/tool-collection/logger"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolLimit(t *testing.T) {
+	p := New[int](context.Background(), 3)
+
+	var running, maxRunning int32
+	for i := 0; i < 20; i++ {
+		i := i
+		err := p.Submit(func(ctx context.Context) (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return i * i, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := p.Wait()
+	if maxRunning > 3 {
+		t.Fatalf("expected at most 3 running tasks, got %d", maxRunning)
+	}
+	if len(results) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Index != i || result.Value != i*i || result.Err != nil {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+
+	if err := p.Submit(func(ctx context.Context) (int, error) { return 0, nil }); !errors.Is(err, PoolClosedErr) {
+		t.Fatalf("expected PoolClosedErr, got %v", err)
+	}
+}
+
+func TestPoolPanic(t *testing.T) {
+	logger.InitLogger()
+	p := New[int](context.Background(), 2)
+	p.Submit(func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+	p.Submit(func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+
+	results := p.Wait()
+	if !errors.Is(results[0].Err, TaskPanicErr) {
+		t.Fatalf("expected TaskPanicErr, got %v", results[0].Err)
+	}
+	if got := results[0].Err.Error(); got != "task panicked: boom" {
+		t.Fatalf("expected no stack in error, got %q", got)
+	}
+	if results[1].Err != nil || results[1].Value != 1 {
+		t.Fatalf("unexpected result %+v", results[1])
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	p := New[int](context.Background(), 1, WithFailFast())
+	failErr := errors.New("fail")
+
+	p.Submit(func(ctx context.Context) (int, error) {
+		return 0, failErr
+	})
+	var executed int32
+	for i := 0; i < 5; i++ {
+		p.Submit(func(ctx context.Context) (int, error) {
+			atomic.AddInt32(&executed, 1)
+			return 0, nil
+		})
+	}
+
+	results := p.Wait()
+	if !errors.Is(p.Err(), failErr) {
+		t.Fatalf("expected first error, got %v", p.Err())
+	}
+	if executed != 0 {
+		t.Fatalf("expected remaining tasks to be cancelled, %d executed", executed)
+	}
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", result.Err)
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package pool
 
-import "context"
+// goWorker 从任务队列中依次取出任务执行 直到队列关闭
+type goWorker[T any] struct {
+	pool *Pool[T]
+}
 
-type goWorker struct {
-	ctx context.Context
+func (w *goWorker[T]) run() {
+	defer w.pool.wg.Done()
+	for t := range w.pool.tasks {
+		w.pool.execute(t)
+	}
 }
@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"bytes"
+)
+
+// audioFormatHeaderSize 识别音频格式时读取的解密后数据长度
+const audioFormatHeaderSize = 12
+
+// SniffAudioFormat 根据解密后的文件头判断音频格式 无法识别时返回空字符串
+func SniffAudioFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return "mp3"
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "ogg"
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return "m4a"
+	case isMpegFrameHeader(header):
+		return "mp3"
+	}
+	return ""
+}
+
+// isMpegFrameHeader 没有ID3标签时 mp3 以帧同步字开头
+// 11位同步字 版本、层、比特率和采样率都不能是保留值 层为0的是AAC(ADTS)
+func isMpegFrameHeader(header []byte) bool {
+	if len(header) < 3 || header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+		return false
+	}
+	version := header[1] >> 3 & 0x03
+	layer := header[1] >> 1 & 0x03
+	bitrate := header[2] >> 4
+	sampleRate := header[2] >> 2 & 0x03
+	return version != 0x01 && layer != 0x00 && bitrate != 0x0f && sampleRate != 0x03
+}
@@ -0,0 +1,31 @@
+package tools
+
+import "testing"
+
+func TestSniffAudioFormat(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   string
+	}{
+		{[]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "mp3"},
+		// MPEG-1 Layer III 128kbps 44.1kHz
+		{[]byte{0xff, 0xfb, 0x90, 0x64}, "mp3"},
+		// MPEG-2 Layer III
+		{[]byte{0xff, 0xf3, 0x48, 0xc4}, "mp3"},
+		// AAC ADTS 层为0
+		{[]byte{0xff, 0xf1, 0x50, 0x80}, ""},
+		// 保留的采样率
+		{[]byte{0xff, 0xfb, 0x9c, 0x64}, ""},
+		{[]byte("fLaC\x00\x00\x00\x22"), "flac"},
+		{[]byte("OggS\x00\x02"), "ogg"},
+		{[]byte("\x00\x00\x00\x20ftypM4A "), "m4a"},
+		{[]byte("RIFF"), ""},
+		{[]byte{0xff}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := SniffAudioFormat(tt.header); got != tt.want {
+			t.Errorf("SniffAudioFormat(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var UnsupportedAudioErr = errors.New("unsupported audio file")
+
+// AudioTag 整理文件时用到的标签
+type AudioTag struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	AlbumArtist string `json:"album_artist"`
+	Album       string `json:"album"`
+	Track       int    `json:"track"`
+}
+
+// IsTaggableAudio 是否是可以读写标签的mp3或flac文件
+func IsTaggableAudio(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp3", ".flac":
+		return true
+	}
+	return false
+}
+
+// ReadAudioTag 读取mp3的ID3v2标签或flac的Vorbis comment 没有标签时返回空值
+func ReadAudioTag(path string) (AudioTag, error) {
+	file, err := readTagFile(path, false)
+	if err != nil {
+		return AudioTag{}, err
+	}
+	first := func(name string) string {
+		if values := file.Fields[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return AudioTag{
+		Title:       first(TagTitle),
+		Artist:      joinArtists(file.Fields[TagArtist]),
+		AlbumArtist: joinArtists(file.Fields[TagAlbumArtist]),
+		Album:       first(TagAlbum),
+		Track:       parseTrackNumber(first(TagTrack)),
+	}, nil
+}
+
+// splitId3Values 按标签版本的分隔符拆分多个值 见 id3Separator
+// ID3v2.4 中 "/" 可能是值的一部分 如 "AC/DC"
+func splitId3Values(text string, version byte) []string {
+	sep := rune(id3Separator(version)[0])
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == sep
+	})
+}
+
+// joinArtists 多个歌手用 ", " 连接 与输出文件名模板一致
+func joinArtists(artists []string) string {
+	names := make([]string, 0, len(artists))
+	for _, artist := range artists {
+		if artist = strings.TrimSpace(artist); artist != "" {
+			names = append(names, artist)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseTrackNumber 支持 "3" 和 "3/12"
+func parseTrackNumber(s string) int {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "/")
+	track, err := strconv.Atoi(s)
+	if err != nil || track < 0 {
+		return 0
+	}
+	return track
+}
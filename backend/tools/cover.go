@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultCoverCacheName 封面缓存目录 放在 ~/.tools_collection 下
+var DefaultCoverCacheName = "covers"
+
+// 源文件同目录下可以作为封面的图片
+var localCoverNames = []string{"cover.jpg", "cover.png", "folder.jpg", "folder.png"}
+
+// 封面下载的超时时间
+var coverFetchTimeout = 30 * time.Second
+
+// CoverResolver 获取写入标签的封面
+// 依次使用 内嵌封面 本地缓存 网络下载 源文件目录下的 cover.jpg/folder.jpg
+// 同一专辑的封面只下载一次 离线模式下不访问网络
+type CoverResolver struct {
+	offline  bool
+	cacheDir string
+	client   *http.Client
+
+	mux sync.Mutex
+	// 每个缓存key一把锁 同一专辑并发转换时只下载一次
+	locks map[string]*sync.Mutex
+	// 本次运行中下载失败的key 不再重试
+	failed map[string]struct{}
+}
+
+// NewCoverResolver cacheDir 为空时使用 ~/.tools_collection/covers
+func NewCoverResolver(cacheDir string, offline bool) *CoverResolver {
+	if cacheDir == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			cacheDir = filepath.Join(homeDir, ".tools_collection", DefaultCoverCacheName)
+		}
+	}
+	return &CoverResolver{
+		offline:  offline,
+		cacheDir: cacheDir,
+		client:   &http.Client{Timeout: coverFetchTimeout},
+		locks:    make(map[string]*sync.Mutex),
+		failed:   make(map[string]struct{}),
+	}
+}
+
+// Resolve 返回封面图片 找不到时返回nil
+func (c *CoverResolver) Resolve(input string, embedded []byte, meta *MetaInfo) []byte {
+	if len(embedded) > 0 {
+		return embedded
+	}
+	if data := c.fromCache(meta); data != nil {
+		return data
+	}
+	return c.fromLocal(input)
+}
+
+// fromCache 读取缓存 不存在时下载并写入缓存
+func (c *CoverResolver) fromCache(meta *MetaInfo) []byte {
+	if meta == nil || meta.AlbumPic == "" {
+		return nil
+	}
+	key := coverCacheKey(meta)
+	lock := c.lock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	path := ""
+	if c.cacheDir != "" {
+		path = filepath.Join(c.cacheDir, key)
+		if data, err := os.ReadFile(path); err == nil && isImage(data) {
+			return data
+		}
+	}
+
+	if c.offline || c.hasFailed(key) {
+		return nil
+	}
+	data, err := c.fetch(meta.AlbumPic)
+	if err != nil {
+		logger.Error(fmt.Sprintf("fetch cover %s failed: %v", meta.AlbumPic, err))
+		c.mux.Lock()
+		c.failed[key] = struct{}{}
+		c.mux.Unlock()
+		return nil
+	}
+
+	if path != "" {
+		if err = os.MkdirAll(c.cacheDir, os.ModePerm); err == nil {
+			err = os.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("write cover cache failed: %v", err))
+		}
+	}
+	return data
+}
+
+func (c *CoverResolver) fromLocal(input string) []byte {
+	dir := filepath.Dir(input)
+	for _, name := range localCoverNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil && isImage(data) {
+			return data
+		}
+	}
+	return nil
+}
+
+func (c *CoverResolver) lock(key string) *sync.Mutex {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	lock, ok := c.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[key] = lock
+	}
+	return lock
+}
+
+func (c *CoverResolver) hasFailed(key string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	_, ok := c.failed[key]
+	return ok
+}
+
+func (c *CoverResolver) fetch(url string) ([]byte, error) {
+	res, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote returned %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !isImage(data) {
+		return nil, fmt.Errorf("response is not an image")
+	}
+	return data, nil
+}
+
+// coverCacheKey 优先使用 albumPicDocId 没有时使用图片地址的sha1
+func coverCacheKey(meta *MetaInfo) string {
+	if id := sanitizeFileName(string(meta.AlbumPicDocID)); id != "" && id != "0" {
+		return id
+	}
+	sum := sha1.Sum([]byte(meta.AlbumPic))
+	return hex.EncodeToString(sum[:])
+}
+
+// isImage 只接受jpeg和png
+func isImage(data []byte) bool {
+	return containPNGHeader(data) || bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff})
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"bytes"
+	"github.com/wanyuqin/tool-collection/logger"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	testJpeg = []byte{0xff, 0xd8, 0xff, 0xe0, 'j', 'p', 'e', 'g'}
+	testPng  = []byte{137, 80, 78, 71, 13, 10, 26, 10, 'p', 'n', 'g'}
+)
+
+func newCoverServer(t *testing.T, status int) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(status)
+		w.Write(testJpeg)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestCoverResolverCache(t *testing.T) {
+	logger.InitLogger()
+	server, hits := newCoverServer(t, http.StatusOK)
+	cacheDir := t.TempDir()
+	meta := &MetaInfo{AlbumPic: server.URL + "/a.jpg", AlbumPicDocID: "109951163"}
+
+	resolver := NewCoverResolver(cacheDir, false)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data := resolver.Resolve("/src/a.ncm", nil, meta); !bytes.Equal(data, testJpeg) {
+				t.Errorf("unexpected cover %v", data)
+			}
+		}()
+	}
+	wg.Wait()
+	if *hits != 1 {
+		t.Fatalf("expected one request, got %d", *hits)
+	}
+
+	// 离线模式使用已有缓存
+	offline := NewCoverResolver(cacheDir, true)
+	if data := offline.Resolve("/src/b.ncm", nil, meta); !bytes.Equal(data, testJpeg) {
+		t.Fatalf("expected cached cover, got %v", data)
+	}
+	if *hits != 1 {
+		t.Fatalf("offline resolver touched the network")
+	}
+
+	if data := resolver.Resolve("/src/a.ncm", testPng, meta); !bytes.Equal(data, testPng) {
+		t.Fatal("expected embedded cover to win")
+	}
+}
+
+func TestCoverResolverFallback(t *testing.T) {
+	logger.InitLogger()
+	server, hits := newCoverServer(t, http.StatusNotFound)
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "folder.jpg"), testJpeg, 0666); err != nil {
+		t.Fatal(err)
+	}
+	meta := &MetaInfo{AlbumPic: server.URL + "/a.jpg"}
+
+	resolver := NewCoverResolver(t.TempDir(), false)
+	for i := 0; i < 3; i++ {
+		if data := resolver.Resolve(filepath.Join(src, "a.ncm"), nil, meta); !bytes.Equal(data, testJpeg) {
+			t.Fatalf("expected local cover, got %v", data)
+		}
+	}
+	if *hits != 1 {
+		t.Fatalf("expected failed fetch not to be retried, got %d requests", *hits)
+	}
+
+	offline := NewCoverResolver(t.TempDir(), true)
+	if data := offline.Resolve(filepath.Join(t.TempDir(), "a.ncm"), nil, meta); data != nil {
+		t.Fatalf("expected no cover, got %v", data)
+	}
+}
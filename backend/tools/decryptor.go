@@ -0,0 +1,244 @@
+package tools
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var UnsupportedFormatErr = errors.New("unsupported encrypted music format")
+
+// decryptorHeaderSize 识别格式时读取的文件头长度
+const decryptorHeaderSize = 16
+
+// Decryptor 加密音乐格式的解密器
+type Decryptor interface {
+	// Name 格式名称
+	Name() string
+	// Extensions 支持的扩展名 包含 "."
+	Extensions() []string
+	// Match 根据文件头判断是否为该格式 没有固定文件头的格式返回false
+	Match(header []byte) bool
+	// Open 打开加密音乐 r 位于文件开头 name 为文件名 用于区分同一格式的不同变种
+	Open(r io.ReadSeeker, name string) (DecryptedAudio, error)
+}
+
+// DecryptedAudio 解密后的音频 Read 返回解密后的音频数据
+type DecryptedAudio interface {
+	io.Reader
+	// Meta 元数据 没有时返回nil
+	Meta() *MetaInfo
+	// Cover 内嵌封面 没有时返回nil
+	Cover() []byte
+	// Format 音频格式 如 mp3 flac 未知时返回空字符串
+	Format() string
+	// AudioSize 音频数据大小
+	AudioSize() int64
+}
+
+// DecryptorRegistry 按扩展名和文件头管理解密器
+type DecryptorRegistry struct {
+	mux sync.RWMutex
+
+	decryptors []Decryptor
+	extensions map[string]Decryptor
+}
+
+var decryptorRegistry = NewDecryptorRegistry()
+
+func NewDecryptorRegistry() *DecryptorRegistry {
+	return &DecryptorRegistry{
+		mux:        sync.RWMutex{},
+		decryptors: make([]Decryptor, 0),
+		extensions: make(map[string]Decryptor),
+	}
+}
+
+// GetDecryptorRegistry 全局解密器注册表
+func GetDecryptorRegistry() *DecryptorRegistry {
+	return decryptorRegistry
+}
+
+// Register 注册解密器 相同扩展名后注册的覆盖先注册的
+func (d *DecryptorRegistry) Register(decryptor Decryptor) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.decryptors = append(d.decryptors, decryptor)
+	for _, ext := range decryptor.Extensions() {
+		d.extensions[strings.ToLower(ext)] = decryptor
+	}
+}
+
+// Find 先根据文件头查找 再根据扩展名查找
+func (d *DecryptorRegistry) Find(name string, header []byte) (Decryptor, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	if len(header) > 0 {
+		for _, decryptor := range d.decryptors {
+			if decryptor.Match(header) {
+				return decryptor, nil
+			}
+		}
+	}
+
+	if decryptor, ok := d.extensions[strings.ToLower(filepath.Ext(name))]; ok {
+		return decryptor, nil
+	}
+	return nil, UnsupportedFormatErr
+}
+
+// Supported 扩展名是否有对应的解密器
+func (d *DecryptorRegistry) Supported(name string) bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	_, ok := d.extensions[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Extensions 所有支持的扩展名
+func (d *DecryptorRegistry) Extensions() []string {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	exts := make([]string, 0, len(d.extensions))
+	for ext := range d.extensions {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// Open 识别格式并打开加密音乐
+func (d *DecryptorRegistry) Open(r io.ReadSeeker, name string) (DecryptedAudio, Decryptor, error) {
+	header := make([]byte, decryptorHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	decryptor, err := d.Find(name, header[:n])
+	if err != nil {
+		return nil, nil, err
+	}
+	audio, err := decryptor.Open(r, name)
+	if err != nil {
+		return nil, decryptor, err
+	}
+	return audio, decryptor, nil
+}
+
+// RegisterDecryptor 注册到全局注册表
+func RegisterDecryptor(decryptor Decryptor) {
+	decryptorRegistry.Register(decryptor)
+}
+
+// IsEncryptedMusic 是否为已注册的加密音乐格式
+func IsEncryptedMusic(name string) bool {
+	return decryptorRegistry.Supported(name)
+}
+
+func init() {
+	RegisterDecryptor(NewNcmDecryptor())
+	RegisterDecryptor(NewQmcDecryptor())
+	RegisterDecryptor(NewKgmDecryptor(""))
+	RegisterDecryptor(NewKwmDecryptor())
+}
+
+// streamCipher 根据音频数据的偏移量解密
+type streamCipher interface {
+	Decrypt(buf []byte, offset int64)
+}
+
+// 超过该大小的数据分块并行解密
+var parallelDecryptThreshold = 256 << 10
+
+// parallelDecrypt 按CPU核数分块并行调用decrypt 只适用于密钥流只和偏移量有关的算法
+func parallelDecrypt(buf []byte, offset int64, decrypt func(buf []byte, offset int64)) {
+	workers := runtime.GOMAXPROCS(0)
+	if len(buf) < parallelDecryptThreshold || workers < 2 {
+		decrypt(buf, offset)
+		return
+	}
+
+	chunk := (len(buf) + workers - 1) / workers
+	wg := sync.WaitGroup{}
+	for start := 0; start < len(buf); start += chunk {
+		end := start + chunk
+		if end > len(buf) {
+			end = len(buf)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			decrypt(buf[start:end], offset+int64(start))
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+// cipherReader 读取时使用 streamCipher 解密
+type cipherReader struct {
+	r      io.Reader
+	cipher streamCipher
+	offset int64
+}
+
+func newCipherReader(r io.Reader, cipher streamCipher) *cipherReader {
+	return &cipherReader{r: r, cipher: cipher}
+}
+
+func (c *cipherReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.cipher.Decrypt(p[:n], c.offset)
+	c.offset += int64(n)
+	return n, err
+}
+
+// decryptedStream 没有元数据的解密音频
+type decryptedStream struct {
+	io.Reader
+	size   int64
+	format string
+}
+
+func (d *decryptedStream) Meta() *MetaInfo {
+	return nil
+}
+
+func (d *decryptedStream) Cover() []byte {
+	return nil
+}
+
+func (d *decryptedStream) Format() string {
+	return d.format
+}
+
+func (d *decryptedStream) AudioSize() int64 {
+	return d.size
+}
+
+// seekSize 获取文件大小 并回到原来的位置
+func seekSize(r io.Seeker) (int64, error) {
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = r.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecryptorRegistry_Find(t *testing.T) {
+	registry := GetDecryptorRegistry()
+
+	cases := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"a.ncm", nil, "ncm"},
+		{"a.bin", []byte("CTENFDAM"), "ncm"},
+		{"a.QMCFLAC", nil, "qmc"},
+		{"a.mflac", nil, "qmc"},
+		{"a.kgm", nil, "kgm"},
+		{"a.dat", vprHeader, "kgm"},
+		{"a.kwm", nil, "kwm"},
+		{"a.mp3", []byte("yeelion-kuwo-tme"), "kwm"},
+	}
+	for _, c := range cases {
+		decryptor, err := registry.Find(c.name, c.header)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if decryptor.Name() != c.want {
+			t.Fatalf("%s: expected %s, got %s", c.name, c.want, decryptor.Name())
+		}
+	}
+
+	if _, err := registry.Find("a.mp3", []byte("ID3")); !errors.Is(err, UnsupportedFormatErr) {
+		t.Fatalf("expected UnsupportedFormatErr, got %v", err)
+	}
+	if !IsEncryptedMusic("/music/a.qmc0") || IsEncryptedMusic("/music/a.flac") {
+		t.Fatal("unexpected IsEncryptedMusic result")
+	}
+}
+
+func TestKwmDecryptor_Open(t *testing.T) {
+	plain := bytes.Repeat([]byte("kuwo music audio"), 100)
+
+	header := make([]byte, kwmAudioOffset)
+	copy(header, "yeelion-kuwo-tme")
+	binary.LittleEndian.PutUint64(header[0x18:], 1234567890123)
+	copy(header[0x30:], "320MP3")
+
+	audio := append([]byte{}, plain...)
+	newKwmCipher(header[0x18:0x20]).Decrypt(audio, 0)
+
+	decrypted, decryptor, err := GetDecryptorRegistry().Open(bytes.NewReader(append(header, audio...)), "a.kwm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decryptor.Name() != "kwm" || decrypted.Format() != "mp3" {
+		t.Fatalf("unexpected decryptor %s format %s", decryptor.Name(), decrypted.Format())
+	}
+	got, err := io.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("decrypted audio mismatch")
+	}
+}
+
+func TestKgmMaskTable(t *testing.T) {
+	data := make([]byte, kgmTableSize*3)
+	for i := range data {
+		data[i] = byte(i*31 + 7)
+	}
+	table, err := newKgmMaskTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		pos  int64
+		want byte
+	}{
+		// 0x110 以下只用 maskV2PreDef
+		{0x05, table.preDef[0x05]},
+		{0x10f, table.preDef[0x10f]},
+		// offset 0x11: table1[0x11] table2[0x01]
+		{0x110, table.preDef[0] ^ table.table1[0x11] ^ table.table2[0x01]},
+		// offset 0x1234: table1[0x1234%272] table2[0x123] 再一轮 table1[0x12] table2[0x01]
+		{0x12345, table.preDef[0x12345%272] ^ table.table1[0x1234%272] ^ table.table2[0x123%272] ^ table.table1[0x12] ^ table.table2[0x01]},
+	}
+	for _, c := range cases {
+		if got := table.mask(c.pos); got != c.want {
+			t.Fatalf("mask(%#x): expected %#x, got %#x", c.pos, c.want, got)
+		}
+	}
+	if _, err = newKgmMaskTable(data[1:]); !errors.Is(err, KgmMaskErr) {
+		t.Fatalf("expected KgmMaskErr, got %v", err)
+	}
+}
+
+func TestKgmDecryptor_Open(t *testing.T) {
+	// 音频比常量表长 密钥流按位置生成
+	plain := bytes.Repeat([]byte("kugou music audio"), 300)
+	data := make([]byte, kgmTableSize*3)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	maskPath := filepath.Join(t.TempDir(), "kgm.mask")
+	if err := os.WriteFile(maskPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	table, err := newKgmMaskTable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, 0x3c)
+	copy(header, kgmHeader)
+	binary.LittleEndian.PutUint32(header[0x10:], uint32(len(header)))
+	copy(header[0x1c:], "0123456789abcdef")
+
+	// 构造加密数据 解密的逆运算
+	key := append([]byte("0123456789abcdef"), 0)
+	audio := make([]byte, len(plain))
+	for i := range plain {
+		msk := table.mask(int64(i))
+		msk ^= (msk & 0xf) << 4
+		med := plain[i] ^ msk
+		med ^= (med & 0xf) << 4
+		audio[i] = med ^ key[i%17]
+	}
+
+	decryptor := NewKgmDecryptor(maskPath)
+	decrypted, err := decryptor.Open(bytes.NewReader(append(header, audio...)), "a.kgm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("decrypted audio mismatch")
+	}
+
+	_, err = NewKgmDecryptor(filepath.Join(t.TempDir(), "missing.mask")).Open(bytes.NewReader(append(header, audio...)), "a.kgm")
+	if !errors.Is(err, KgmMaskErr) {
+		t.Fatalf("expected KgmMaskErr, got %v", err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"github.com/wanyuqin/lux/extractors"
 	"github.com/wanyuqin/lux/request"
 	"github.com/wanyuqin/lux/utils"
+	"github.com/wanyuqin/tool-collection/backend/pool"
 	"github.com/wanyuqin/tool-collection/configs"
 	"github.com/wanyuqin/tool-collection/logger"
 	"io"
@@ -21,28 +23,55 @@ import (
 var defaultThreadNumber = 10
 var defaultRetryTimes = 3
 var FileExistErr = errors.New("file already exists")
-
-var LinkDataMap map[string]*extractors.Data
+var DownloadPausedErr = errors.New("download paused")
+var DownloadRunningErr = errors.New("download is running")
+var StreamNotFoundErr = errors.New("stream not found")
+
+// 解析结果 下载时按ID查找 解析和下载在不同的goroutine中
+var (
+	linkDataMux sync.RWMutex
+	linkDataMap = make(map[string]*extractors.Data)
+)
 
 type ExtractLinkData struct {
-	Id         string  `json:"id"`
-	Title      string  `json:"title"`
-	Type       string  `json:"type"`
-	Url        string  `json:"url"`
-	Quality    string  `json:"quality"`
+	Id      string `json:"id"`
+	Title   string `json:"title"`
+	Type    string `json:"type"`
+	Url     string `json:"url"`
+	Quality string `json:"quality"`
+	// 下载的清晰度 为空时按设置选择
+	Stream     string  `json:"stream"`
 	Size       string  `json:"size"`
 	Byte       int64   `json:"byte"`
 	Percentage float64 `json:"percentage"` // 百分比
+	// 可以选择的清晰度 按大小倒序
+	Streams []StreamInfo `json:"streams"`
 }
 
 type StreamInfo struct {
+	ID      string `json:"id"`
 	Quality string `json:"quality"`
 	Size    string `json:"size"`
 	Byte    int64  `json:"byte"`
+	// 容器格式 如 mp4 flv
+	Ext string `json:"ext"`
+	// 音视频分开 需要合并
+	NeedMux bool `json:"need_mux"`
+}
+
+// getLinkData 按ID获取解析结果
+func getLinkData(id string) (*extractors.Data, bool) {
+	linkDataMux.RLock()
+	defer linkDataMux.RUnlock()
+	data, ok := linkDataMap[id]
+	return data, ok
 }
 
-func init() {
-	LinkDataMap = make(map[string]*extractors.Data)
+// putLinkData 保存解析结果
+func putLinkData(id string, data *extractors.Data) {
+	linkDataMux.Lock()
+	defer linkDataMux.Unlock()
+	linkDataMap[id] = data
 }
 
 // ExtractLink 解析地址网页内容
@@ -58,6 +87,7 @@ func ExtractLink(link string) ([]ExtractLinkData, error) {
 		return nil, err
 	}
 
+	rule := configs.GetConfig().Download.Stream
 	elds := make([]ExtractLinkData, 0, len(data))
 	for i, item := range data {
 		uid, err := uuid.NewUUID()
@@ -66,28 +96,12 @@ func ExtractLink(link string) ([]ExtractLinkData, error) {
 			continue
 		}
 
-		eld := ExtractLinkData{
-			Title: item.Title,
-			Url:   item.URL,
-			Type:  string(item.Type),
-			Id:    uid.String(),
-		}
-
-		sortStreams := GenSortedStreams(item.Streams)
-		if len(sortStreams) > 0 {
-			streamName := sortStreams[0].ID
-			stream, ok := item.Streams[streamName]
-			if !ok {
-				continue
-
-			}
-			streamInfo := GetStreamInfo(stream)
-			eld.Size = streamInfo.Size
-			eld.Quality = streamInfo.Quality
-			eld.Byte = streamInfo.Byte
+		eld, err := newExtractLinkData(uid.String(), item, "", rule)
+		if err != nil {
+			continue
 		}
 
-		LinkDataMap[uid.String()] = data[i]
+		putLinkData(uid.String(), data[i])
 
 		elds = append(elds, eld)
 	}
@@ -95,8 +109,49 @@ func ExtractLink(link string) ([]ExtractLinkData, error) {
 	return elds, err
 }
 
+// newExtractLinkData stream 为空或不存在时按 rule 选择清晰度
+func newExtractLinkData(id string, item *extractors.Data, stream, rule string) (ExtractLinkData, error) {
+	eld := ExtractLinkData{
+		Title:   item.Title,
+		Url:     item.URL,
+		Type:    string(item.Type),
+		Id:      id,
+		Streams: make([]StreamInfo, 0, len(item.Streams)),
+	}
+	if len(item.Streams) == 0 {
+		return eld, nil
+	}
+	for _, id := range sortedStreamIDs(item.Streams) {
+		streamInfo := GetStreamInfo(item.Streams[id])
+		streamInfo.ID = id
+		eld.Streams = append(eld.Streams, streamInfo)
+	}
+	if _, ok := item.Streams[stream]; ok {
+		eld.Stream = stream
+	}
+	return resolveStream(eld, item, rule)
+}
+
+// ExtractHistoryLink 重新解析下载记录的地址 有多个结果时优先返回标题相同的
+func ExtractHistoryLink(id string) ([]ExtractLinkData, error) {
+	entry, err := GetDownloadHistory().Get(id)
+	if err != nil {
+		return nil, err
+	}
+	elds, err := ExtractLink(entry.Url)
+	if err != nil {
+		return nil, err
+	}
+	for _, eld := range elds {
+		if eld.Title == entry.Title {
+			return []ExtractLinkData{eld}, nil
+		}
+	}
+	return elds, nil
+}
+
 func Download(ctx context.Context, eld ExtractLinkData) error {
-	data, ok := LinkDataMap[eld.Id]
+	data, ok := getLinkData(eld.Id)
 	if !ok {
 		return errors.New("数据未找到")
 	}
@@ -107,32 +162,126 @@ func Download(ctx context.Context, eld ExtractLinkData) error {
 	if err != nil {
 		return err
 	}
+	// 选择的清晰度 大小用于计算进度
+	if eld, err = resolveStream(eld, data, config.Download.Stream); err != nil {
+		return err
+	}
 
 	options := &DownloadOptions{
 		Ctx:          ctx,
 		Eld:          eld,
 		Data:         data,
 		DownloadPath: config.Download.Path,
+		Threads:      config.Download.Threads,
 		mux:          sync.RWMutex{},
 		doneByte:     0,
 	}
 	// 开始下载 加入下载队列
 	GetDownloadList().Push(eld.Id)
+	entry := DownloadHistoryEntry{
+		ID:        eld.Id,
+		Url:       data.URL,
+		Site:      data.Site,
+		Title:     eld.Title,
+		Quality:   eld.Quality,
+		Size:      eld.Byte,
+		StartTime: time.Now().Unix(),
+		State:     DownloadStateDownloading,
+	}
+	if entry.Site == "" {
+		entry.Site = utils.Domain(data.URL)
+	}
+	// 继续暂停或中断的下载时 保留开始时间
+	if old, getErr := GetDownloadHistory().Get(eld.Id); getErr == nil {
+		entry.StartTime = old.StartTime
+	}
+	updateDownloadState(ctx, entry)
+
 	err = download(options)
+
+	entry.Output = options.Output
+	entry.EndTime = time.Now().Unix()
+	switch {
+	case err == nil:
+		entry.State = DownloadStateDone
+	case errors.Is(err, FileExistErr):
+		entry.State = DownloadStateSkipped
+	case errors.Is(err, DownloadPausedErr):
+		entry.State = DownloadStatePaused
+		entry.EndTime = 0
+	case errors.Is(err, context.Canceled):
+		entry.State = DownloadStateCanceled
+	default:
+		entry.State = DownloadStateFailed
+		entry.Error = err.Error()
+	}
+
+	// 暂停的任务保留 取消时删除已下载的分片
+	var taskErr error
+	switch entry.State {
+	case DownloadStatePaused:
+	case DownloadStateCanceled:
+		taskErr = GetDownloadTaskStore().Discard(eld.Id)
+	default:
+		taskErr = GetDownloadTaskStore().Remove(eld.Id)
+	}
+	if taskErr != nil {
+		logger.Error(fmt.Sprintf("remove download task %s failed: %v", eld.Title, taskErr))
+	}
+
+	updateDownloadState(ctx, entry)
 	return err
 }
 
+// EnqueueDownload 加入下载队列 下载结束后返回
+// 排队时保存任务 退出后下次启动也可以继续
+func EnqueueDownload(ctx context.Context, eld ExtractLinkData) error {
+	data, ok := getLinkData(eld.Id)
+	if !ok {
+		return errors.New("数据未找到")
+	}
+	eld, err := resolveStream(eld, data, configs.GetConfig().Download.Stream)
+	if err != nil {
+		return err
+	}
+	// 继续下载时保留已有的分片信息
+	if _, err = GetDownloadTaskStore().Get(eld.Id); err != nil {
+		task := DownloadTask{
+			ID:      eld.Id,
+			Url:     data.URL,
+			Title:   data.Title,
+			Stream:  eld.Stream,
+			Quality: eld.Quality,
+			Size:    eld.Byte,
+			AddTime: time.Now().Unix(),
+		}
+		if err = GetDownloadTaskStore().Save(task); err != nil {
+			logger.Error(fmt.Sprintf("save download task %s failed: %v", eld.Title, err))
+		}
+	}
+	return GetDownloadScheduler().Submit(ctx, eld)
+}
+
+// updateDownloadState 记录下载历史并通知前端 记录失败不影响下载
+func updateDownloadState(ctx context.Context, entry DownloadHistoryEntry) {
+	if err := GetDownloadHistory().Save(entry); err != nil {
+		logger.Error(fmt.Sprintf("save download history %s failed: %v", entry.Title, err))
+	}
+	runtime.EventsEmit(ctx, DownloadStateChange, entry)
+}
+
 func download(options *DownloadOptions) error {
 	data := options.Data
 	if len(data.Streams) == 0 {
 		return errors.New(fmt.Sprintf("no streams in title %s", data.Title))
 	}
 
-	sortStreams := GenSortedStreams(data.Streams)
-
 	title := data.Title
 
-	streamName := sortStreams[0].ID
+	streamName := options.Eld.Stream
+	if _, ok := data.Streams[streamName]; !ok {
+		streamName = SelectStream(data.Streams, configs.StreamBest)
+	}
 	//stream 具体文件内容流
 	stream, ok := data.Streams[streamName]
 
@@ -157,6 +306,7 @@ func download(options *DownloadOptions) error {
 	if err != nil {
 		return err
 	}
+	options.Output = mergedFilePath
 
 	_, mergedFileExists, err := utils.FileSize(mergedFilePath)
 	if err != nil {
@@ -168,53 +318,68 @@ func download(options *DownloadOptions) error {
 		return FileExistErr
 	}
 
-	wgp := utils.NewWaitGroupPool(defaultThreadNumber)
-	errs := make([]error, 0)
-	lock := sync.Mutex{}
 	parts := make([]string, len(stream.Parts))
+	for index, part := range stream.Parts {
+		partFileName := fmt.Sprintf("%s[%d]", title, index)
+		if parts[index], err = utils.FilePath(partFileName, part.Ext, 0, options.DownloadPath, false); err != nil {
+			return err
+		}
+	}
+	// 保存下载任务 程序退出后可以继续下载
+	task := DownloadTask{
+		ID:      options.Eld.Id,
+		Url:     data.URL,
+		Title:   title,
+		Stream:  streamName,
+		Quality: stream.Quality,
+		Size:    stream.Size,
+		Output:  mergedFilePath,
+		Parts:   parts,
+		AddTime: time.Now().Unix(),
+	}
+	if old, getErr := GetDownloadTaskStore().Get(task.ID); getErr == nil {
+		task.AddTime = old.AddTime
+	}
+	if err = GetDownloadTaskStore().Save(task); err != nil {
+		logger.Error(fmt.Sprintf("save download task %s failed: %v", title, err))
+	}
 
 	// 每一个下载任务都要有一个ctx，用来控制goroutine的终止
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	GetDownloadPool().Add(options.Eld.Id, cancel)
+	defer GetDownloadPool().Remove(options.Eld.Id)
+
+	threads := options.Threads
+	if threads <= 0 {
+		threads = defaultThreadNumber
+	}
+	// 任意分片失败时停止下载剩余分片
+	p := pool.New[struct{}](ctx, threads, pool.WithFailFast())
 
 	for index, part := range stream.Parts {
-		if len(errs) > 0 {
-			break
-		}
 		partFileName := fmt.Sprintf("%s[%d]", title, index)
-		partFilePath, err := utils.FilePath(partFileName, part.Ext, 0, options.DownloadPath, false)
+		part := part
+		// 去下载每个part
+		err = p.Submit(func(ctx context.Context) (struct{}, error) {
+			return struct{}{}, save(ctx, part, data.URL, partFileName, options)
+		})
 		if err != nil {
-			return err
+			break
 		}
-		parts[index] = partFilePath
-
-		wgp.Add()
-		// 去下载每个part
-		go func(ctx context.Context, part *extractors.Part, fileName string, options *DownloadOptions) {
-			defer wgp.Done()
-			//	var err error
-			//if downloader.option.MultiThread {
-			//	err = downloader.multiThreadSave(part, data.URL, fileName)
-			//} else {
-			//	err = downloader.save(part, data.URL, fileName)
-			//}
-			// 文件保存
-			err = save(ctx, part, data.URL, fileName, options)
-			//err = save(part, data.URL, partFileName)
-			if err != nil {
-				lock.Lock()
-				errs = append(errs, err)
-				lock.Unlock()
-			}
-
-			//// 下载完成之后计算百分比
-			//options.CalculatePercent()
-
-		}(ctx, part, partFileName, options)
-
 	}
 
-	wgp.Wait()
+	p.Wait()
+	// 暂停或取消时分片没有下载完 不合并
+	if err = ctx.Err(); err != nil {
+		if GetDownloadPool().IsPaused(options.Eld.Id) {
+			return DownloadPausedErr
+		}
+		return err
+	}
+	if err = p.Err(); err != nil {
+		return err
+	}
 
 	if stream.Ext != "mp4" || stream.NeedMux {
 		return utils.MergeFilesWithSameExtension(parts, mergedFilePath)
@@ -238,7 +403,10 @@ func GenSortedStreams(streams map[string]*extractors.Stream) []*extractors.Strea
 
 func GetStreamInfo(stream *extractors.Stream) StreamInfo {
 	return StreamInfo{
+		ID:      stream.ID,
 		Quality: stream.Quality,
+		Ext:     stream.Ext,
+		NeedMux: stream.NeedMux,
 		Size:    fmt.Sprintf("%.2f MiB", float64(stream.Size)/(1024*1024)),
 		Byte:    stream.Size,
 	}
@@ -291,6 +459,8 @@ func save(ctx context.Context, part *extractors.Part, refer, fileName string, op
 		}
 		fileSize, exists, err := utils.FileSize(filePath)
 		if exists && fileSize == part.Size {
+			// 上次已下载完的分片 计入进度
+			options.AddDoneByte(fileSize)
 			return nil
 		}
 
@@ -308,6 +478,7 @@ func save(ctx context.Context, part *extractors.Part, refer, fileName string, op
 			fileError error
 		)
 		if tempFileSize > 0 {
+			options.AddDoneByte(tempFileSize)
 			// range start from 0, 0-1023 means the first 1024 bytes of the file
 			headers["Range"] = fmt.Sprintf("bytes=%d-", tempFileSize)
 			file, fileError = os.OpenFile(tempFilePath, os.O_APPEND|os.O_WRONLY, 0644)
@@ -328,12 +499,19 @@ func save(ctx context.Context, part *extractors.Part, refer, fileName string, op
 		// 下载内容大小
 		temp := tempFileSize
 		for i := 0; ; i++ {
-			written, err := writeFile(part.URL, file, headers)
+			var written, start int64
+			written, start, err = writeFile(ctx, part.URL, file, headers)
+			if start != temp {
+				// 服务器不支持断点续传 临时文件已清空 从头下载
+				options.AddDoneByte(start - temp)
+				temp = start
+			}
+			options.AddDoneByte(written)
 			if err == nil {
-				options.AddDoneByte(written)
 				options.CalculatePercent()
 				break
-			} else if i+1 >= defaultRetryTimes {
+			} else if ctx.Err() != nil || i+1 >= defaultRetryTimes {
+				// 暂停或取消时保留临时文件 继续时从当前位置下载
 				return err
 			}
 			temp += written
@@ -343,31 +521,210 @@ func save(ctx context.Context, part *extractors.Part, refer, fileName string, op
 
 		return nil
 	}
-	return nil
 }
 
-func writeFile(url string, file *os.File, headers map[string]string) (int64, error) {
+// writeFile 边读边写 ctx 取消时关闭响应中断读取 已写入的内容保留
+// 返回写入的字节数和写入的起始位置 服务器没有按 Range 返回时清空文件从头写入 起始位置为0
+func writeFile(ctx context.Context, url string, file *os.File, headers map[string]string) (int64, int64, error) {
+	var start int64
+	if rg, ok := headers["Range"]; ok {
+		fmt.Sscanf(rg, "bytes=%d-", &start) // nolint
+	}
 	res, err := request.Request(http.MethodGet, url, nil, headers)
 	if err != nil {
-		return 0, err
+		return 0, start, err
 	}
 	defer res.Body.Close() // nolint
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return 0, err
+	if start > 0 && !rangeMatched(res, start) {
+		if err = file.Truncate(0); err != nil {
+			return 0, start, err
+		}
+		start = 0
+		// 返回的不是完整内容 不带 Range 重新请求
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close() // nolint
+			restart := make(map[string]string, len(headers))
+			for k, v := range headers {
+				if k != "Range" {
+					restart[k] = v
+				}
+			}
+			return writeFile(ctx, url, file, restart)
+		}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			res.Body.Close() // nolint
+		case <-stop:
+		}
+	}()
+
+	written, err := io.Copy(file, res.Body)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return written, start, ctxErr
+	}
+	return written, start, err
+}
+
+// rangeMatched 是否返回了从 start 开始的部分内容 如 Content-Range: bytes 100-999/1000
+func rangeMatched(res *http.Response, start int64) bool {
+	if res.StatusCode != http.StatusPartialContent {
+		return false
+	}
+	var from int64
+	if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-", &from); err != nil {
+		return false
+	}
+	return from == start
+}
+
+// UnfinishedDownloads 上次退出时没有完成的下载 不包含正在下载和排队中的
+func UnfinishedDownloads() []DownloadTask {
+	return unfinishedTasks(GetDownloadTaskStore().List(), GetDownloadScheduler())
+}
+
+// unfinishedTasks 排队中的任务也在任务列表中 再次继续会被队列当作重复任务拒绝
+func unfinishedTasks(tasks []DownloadTask, scheduler *DownloadScheduler) []DownloadTask {
+	result := make([]DownloadTask, 0)
+	for _, task := range tasks {
+		if !GetDownloadList().Contains(task.ID) && !scheduler.Contains(task.ID) {
+			result = append(result, task)
+		}
+	}
+	return result
+}
+
+// ResumeDownloads 重新解析未完成下载的地址 保留原来的ID和清晰度 返回的数据可以直接调用 Download
+// 已下载的分片不会重复下载 解析失败的任务保留 下次启动时再处理
+func ResumeDownloads(ids []string) ([]ExtractLinkData, error) {
+	elds := make([]ExtractLinkData, 0, len(ids))
+	var errs []error
+	for _, id := range ids {
+		task, err := GetDownloadTaskStore().Get(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		eld, err := extractTask(task)
+		if err != nil {
+			logger.Error(fmt.Sprintf("resume download %s failed: %v", task.Title, err))
+			errs = append(errs, fmt.Errorf("%s: %w", task.Title, err))
+			continue
+		}
+		elds = append(elds, eld)
 	}
+	if len(elds) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return elds, nil
+}
 
-	written, err := file.Write(body)
+func extractTask(task DownloadTask) (ExtractLinkData, error) {
+	data, err := extractors.Extract(task.Url, extractors.Options{})
 	if err != nil {
-		return int64(written), err
+		return ExtractLinkData{}, err
 	}
-	return int64(written), nil
+	eld, item, err := taskLinkData(task, data, configs.GetConfig().Download.Stream)
+	if err != nil {
+		return eld, err
+	}
+	putLinkData(task.ID, item)
+	return eld, nil
+}
+
+// taskLinkData 从重新解析的结果中找到任务对应的数据
+// 分片文件名和清晰度无关 已有分片时只能使用原来的清晰度 否则会接在原来的分片后面
+func taskLinkData(task DownloadTask, data []*extractors.Data, rule string) (ExtractLinkData, *extractors.Data, error) {
+	if len(data) == 0 {
+		return ExtractLinkData{}, nil, errors.New("no data extracted")
+	}
+	// 分片文件名由标题决定 优先使用标题相同的结果
+	item := data[0]
+	for _, d := range data {
+		if d.Title == task.Title {
+			item = d
+			break
+		}
+	}
+	if _, ok := item.Streams[task.Stream]; !ok && len(task.Parts) > 0 {
+		return ExtractLinkData{}, nil, fmt.Errorf("%w: %s", StreamNotFoundErr, task.Stream)
+	}
+	eld, err := newExtractLinkData(task.ID, item, task.Stream, rule)
+	return eld, item, err
+}
+
+// DiscardDownloads 放弃未完成的下载 删除已下载的分片
+func DiscardDownloads(ids []string) error {
+	return GetDownloadTaskStore().Discard(ids...)
 }
 
 func CancelDownload(id string) {
-	// 取消下载任务
-	GetDownloadPool().Cancel(id)
-	// 删除临时文件
-	GetDownloadList().ClearTempFile(id)
+	// 取消下载任务 下载结束时删除已下载的分片
+	if GetDownloadPool().Cancel(id) {
+		// 删除临时文件
+		GetDownloadList().ClearTempFile(id)
+		return
+	}
+	// 等待中或暂停的下载 直接删除
+	GetDownloadScheduler().Remove(id)
+	if err := DiscardDownloads([]string{id}); err != nil {
+		logger.Error(fmt.Sprintf("discard download %s failed: %v", id, err))
+	}
+	if entry, err := GetDownloadHistory().Get(id); err == nil && entry.State == DownloadStatePaused {
+		entry.State = DownloadStateCanceled
+		entry.EndTime = time.Now().Unix()
+		if err = GetDownloadHistory().Save(entry); err != nil {
+			logger.Error(fmt.Sprintf("save download history %s failed: %v", entry.Title, err))
+		}
+	}
+	GetDownloadList().Pop(id)
+}
+
+// PauseDownload 暂停下载 保留已下载的分片 调用 ResumeDownload 继续
+// 等待中的下载移出队列 记录为暂停
+func PauseDownload(ctx context.Context, id string) error {
+	if GetDownloadPool().Pause(id) {
+		return nil
+	}
+	task, err := GetDownloadTaskStore().Get(id)
+	if err != nil {
+		return err
+	}
+	if !GetDownloadScheduler().Pause(id) {
+		return DownloadTaskNotFoundErr
+	}
+	// 中断后重新排队的任务已有记录
+	entry, err := GetDownloadHistory().Get(id)
+	if err != nil {
+		entry = DownloadHistoryEntry{
+			ID:        task.ID,
+			Url:       task.Url,
+			Site:      utils.Domain(task.Url),
+			Title:     task.Title,
+			Quality:   task.Quality,
+			Size:      task.Size,
+			StartTime: task.AddTime,
+		}
+	}
+	entry.State = DownloadStatePaused
+	entry.EndTime = 0
+	updateDownloadState(ctx, entry)
+	return nil
+}
+
+// ResumeDownload 重新解析暂停的下载 下载地址可能已过期 返回的数据调用 Download 从已下载的位置继续
+func ResumeDownload(id string) (ExtractLinkData, error) {
+	if GetDownloadPool().Running(id) {
+		return ExtractLinkData{}, DownloadRunningErr
+	}
+	task, err := GetDownloadTaskStore().Get(id)
+	if err != nil {
+		return ExtractLinkData{}, err
+	}
+	return extractTask(task)
 }
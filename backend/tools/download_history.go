@@ -1,6 +1,306 @@
 package tools
 
-//// 初始化存储文件
-//func ()  {
-//
-//}
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var DownloadHistoryNotFoundErr = errors.New("download history not found")
+
+// DefaultDownloadHistoryName 下载历史 放在 ~/.tools_collection 下
+var DefaultDownloadHistoryName = "download_history.jsonl"
+
+// 下载状态
+const (
+	// 在下载队列中等待
+	DownloadStateQueued      = "queued"
+	DownloadStateDownloading = "downloading"
+	DownloadStateDone        = "done"
+	DownloadStateFailed      = "failed"
+	DownloadStateCanceled    = "canceled"
+	// 文件已存在 没有下载
+	DownloadStateSkipped = "skipped"
+	// 下载中程序退出
+	DownloadStateInterrupted = "interrupted"
+	// 暂停 保留已下载的分片
+	DownloadStatePaused = "paused"
+)
+
+// 默认每页条数
+const defaultHistoryPageSize = 20
+
+// DownloadHistoryEntry 一次下载的记录
+type DownloadHistoryEntry struct {
+	ID      string `json:"id"`
+	Url     string `json:"url"`
+	Site    string `json:"site"`
+	Title   string `json:"title"`
+	Quality string `json:"quality"`
+	Size    int64  `json:"size"` // 字节
+	Output  string `json:"output"`
+	// 秒 未结束时 EndTime 为0
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	State     string `json:"state"`
+	Error     string `json:"error"`
+	// 删除标记 只在文件中使用
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// DownloadHistoryQuery 查询条件 为空的条件不过滤
+type DownloadHistoryQuery struct {
+	// 标题包含的文字 不区分大小写
+	Title string `json:"title"`
+	// 网站名或域名包含的文字
+	Site  string `json:"site"`
+	State string `json:"state"`
+	// 开始下载时间的范围 秒 包含 Since 不包含 Until
+	Since int64 `json:"since"`
+	Until int64 `json:"until"`
+	// 从1开始
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// DownloadHistoryPage 一页查询结果 按开始时间倒序
+type DownloadHistoryPage struct {
+	Total   int                    `json:"total"`
+	Entries []DownloadHistoryEntry `json:"entries"`
+}
+
+// DownloadHistory 下载历史 每行一条JSON 追加写入 同一个ID以最后一行为准
+// 打开时无效的行较多会重写文件
+type DownloadHistory struct {
+	mux     sync.RWMutex
+	path    string
+	entries map[string]DownloadHistoryEntry
+}
+
+var (
+	downloadHistory     *DownloadHistory
+	downloadHistoryOnce sync.Once
+)
+
+// GetDownloadHistory 默认位置的下载历史 读取失败时只记录在内存中
+func GetDownloadHistory() *DownloadHistory {
+	downloadHistoryOnce.Do(func() {
+		var err error
+		if downloadHistory, err = OpenDownloadHistory(""); err != nil {
+			logger.Error(fmt.Sprintf("open download history failed: %v", err))
+			downloadHistory = &DownloadHistory{entries: make(map[string]DownloadHistoryEntry)}
+		}
+	})
+	return downloadHistory
+}
+
+// OpenDownloadHistory path 为空时使用 ~/.tools_collection/download_history.jsonl
+func OpenDownloadHistory(path string) (*DownloadHistory, error) {
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(homeDir, ".tools_collection", DefaultDownloadHistoryName)
+	}
+	h := &DownloadHistory{
+		path:    path,
+		entries: make(map[string]DownloadHistoryEntry),
+	}
+
+	fp, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines++
+		var entry DownloadHistoryEntry
+		// 忽略写入中断导致的不完整的行
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+			logger.Debug(fmt.Sprintf("skip broken download history line: %v", err))
+			continue
+		}
+		if entry.Deleted {
+			delete(h.entries, entry.ID)
+			continue
+		}
+		h.entries[entry.ID] = entry
+	}
+	for id, entry := range h.entries {
+		// 上次运行时没有下载完
+		if entry.State == DownloadStateDownloading {
+			entry.State = DownloadStateInterrupted
+			h.entries[id] = entry
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// 每个下载至少有开始和结束两行
+	if lines > 2*len(h.entries)+100 {
+		if err = h.rewrite(); err != nil {
+			logger.Error(fmt.Sprintf("compact download history failed: %v", err))
+		}
+	}
+	return h, nil
+}
+
+// Save 新增或更新记录
+func (h *DownloadHistory) Save(entry DownloadHistoryEntry) error {
+	entry.Deleted = false
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.entries[entry.ID] = entry
+	return h.append(entry)
+}
+
+// Get 按ID获取记录
+func (h *DownloadHistory) Get(id string) (DownloadHistoryEntry, error) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	entry, ok := h.entries[id]
+	if !ok {
+		return entry, DownloadHistoryNotFoundErr
+	}
+	return entry, nil
+}
+
+// List 按条件分页查询
+func (h *DownloadHistory) List(query DownloadHistoryQuery) DownloadHistoryPage {
+	title := strings.ToLower(strings.TrimSpace(query.Title))
+	site := strings.ToLower(strings.TrimSpace(query.Site))
+
+	h.mux.RLock()
+	matched := make([]DownloadHistoryEntry, 0)
+	for _, entry := range h.entries {
+		if title != "" && !strings.Contains(strings.ToLower(entry.Title), title) {
+			continue
+		}
+		if site != "" && !strings.Contains(strings.ToLower(entry.Site), site) && !strings.Contains(strings.ToLower(entry.Url), site) {
+			continue
+		}
+		if query.State != "" && entry.State != query.State {
+			continue
+		}
+		if (query.Since > 0 && entry.StartTime < query.Since) || (query.Until > 0 && entry.StartTime >= query.Until) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	h.mux.RUnlock()
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].StartTime != matched[j].StartTime {
+			return matched[i].StartTime > matched[j].StartTime
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	page, size := query.Page, query.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = defaultHistoryPageSize
+	}
+	start := (page - 1) * size
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := start + size
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return DownloadHistoryPage{
+		Total:   len(matched),
+		Entries: matched[start:end],
+	}
+}
+
+// Delete 删除记录 不删除下载的文件
+func (h *DownloadHistory) Delete(ids ...string) error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for _, id := range ids {
+		if _, ok := h.entries[id]; !ok {
+			continue
+		}
+		delete(h.entries, id)
+		if err := h.append(DownloadHistoryEntry{ID: id, Deleted: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear 清空记录 正在下载的记录保留
+func (h *DownloadHistory) Clear() error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for id, entry := range h.entries {
+		if entry.State != DownloadStateDownloading {
+			delete(h.entries, id)
+		}
+	}
+	return h.rewrite()
+}
+
+func (h *DownloadHistory) append(entry DownloadHistoryEntry) error {
+	if h.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(h.path), os.ModePerm); err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = fp.Write(append(line, '\n'))
+	return err
+}
+
+// rewrite 只保留有效的记录 先写临时文件再替换
+func (h *DownloadHistory) rewrite() error {
+	if h.path == "" {
+		return nil
+	}
+	buf := &strings.Builder{}
+	for _, entry := range h.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"errors"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDownloadHistory(t *testing.T) {
+	logger.InitLogger()
+	path := filepath.Join(t.TempDir(), DefaultDownloadHistoryName)
+	history, err := OpenDownloadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []DownloadHistoryEntry{
+		{ID: "1", Title: "Go 并发编程", Site: "哔哩哔哩 bilibili.com", Url: "https://www.bilibili.com/video/BV1", StartTime: 100, State: DownloadStateDone},
+		{ID: "2", Title: "Rust 入门", Site: "YouTube youtube.com", Url: "https://www.youtube.com/watch?v=2", StartTime: 200, State: DownloadStateFailed, Error: "timeout"},
+		{ID: "3", Title: "go modules", Site: "哔哩哔哩 bilibili.com", Url: "https://www.bilibili.com/video/BV3", StartTime: 300, State: DownloadStateDownloading},
+	}
+	for _, entry := range entries {
+		if err = history.Save(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一个ID更新状态
+	entries[0].EndTime = 150
+	entries[0].Output = "/tmp/Go 并发编程.mp4"
+	if err = history.Save(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(page DownloadHistoryPage) []string {
+		result := make([]string, 0, len(page.Entries))
+		for _, entry := range page.Entries {
+			result = append(result, entry.ID)
+		}
+		return result
+	}
+	tests := []struct {
+		query DownloadHistoryQuery
+		total int
+		want  []string
+	}{
+		{DownloadHistoryQuery{}, 3, []string{"3", "2", "1"}},
+		{DownloadHistoryQuery{Title: "GO"}, 2, []string{"3", "1"}},
+		{DownloadHistoryQuery{Site: "youtube"}, 1, []string{"2"}},
+		{DownloadHistoryQuery{State: DownloadStateFailed}, 1, []string{"2"}},
+		{DownloadHistoryQuery{Since: 150, Until: 300}, 1, []string{"2"}},
+		{DownloadHistoryQuery{Page: 2, PageSize: 2}, 3, []string{"1"}},
+		{DownloadHistoryQuery{Page: 3, PageSize: 2}, 3, []string{}},
+	}
+	for _, tt := range tests {
+		page := history.List(tt.query)
+		if page.Total != tt.total || !reflect.DeepEqual(ids(page), tt.want) {
+			t.Fatalf("%+v: expected %d %v, got %d %v", tt.query, tt.total, tt.want, page.Total, ids(page))
+		}
+	}
+
+	if err = history.Delete("2", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = history.Get("2"); !errors.Is(err, DownloadHistoryNotFoundErr) {
+		t.Fatalf("expected DownloadHistoryNotFoundErr, got %v", err)
+	}
+
+	// 不完整的行被忽略 上次没有下载完的记录标记为中断
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.WriteString(`{"id":"4","tit`)
+	fp.Close()
+	history, err = OpenDownloadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(history.List(DownloadHistoryQuery{})); !reflect.DeepEqual(got, []string{"3", "1"}) {
+		t.Fatalf("unexpected entries after reopen %v", got)
+	}
+	if entry, _ := history.Get("1"); !reflect.DeepEqual(entry, entries[0]) {
+		t.Fatalf("expected %+v, got %+v", entries[0], entry)
+	}
+	if entry, _ := history.Get("3"); entry.State != DownloadStateInterrupted {
+		t.Fatalf("expected interrupted, got %+v", entry)
+	}
+
+	if err = history.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if history, err = OpenDownloadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	if page := history.List(DownloadHistoryQuery{}); page.Total != 0 {
+		t.Fatalf("expected empty history, got %+v", page)
+	}
+}
@@ -14,14 +14,22 @@ import (
 
 var DownloadPercentRefresh = "download.percent.refresh"
 
+// DownloadStateChange 下载状态变化 发送 DownloadHistoryEntry
+var DownloadStateChange = "download.state.change"
+
 // DownloadOptions 下载参数
 type DownloadOptions struct {
 	Data         *extractors.Data
 	DownloadPath string
+	// 同时下载的分片数
+	Threads int
 	// wails ctx
 	Ctx context.Context
 
-	Eld      ExtractLinkData
+	Eld ExtractLinkData
+	// 合并后的文件路径 开始下载后设置
+	Output string
+
 	mux      sync.RWMutex
 	doneByte int64 // 已完成的数据大小
 }
@@ -130,6 +138,14 @@ func (dl *DownloadList) Pop(id string) {
 	delete(dl.Table, id)
 }
 
+// Contains 是否正在下载
+func (dl *DownloadList) Contains(id string) bool {
+	dl.mux.RLock()
+	defer dl.mux.RUnlock()
+	_, ok := dl.Table[id]
+	return ok
+}
+
 func (dl *DownloadList) Length() int {
 	dl.mux.Lock()
 	defer dl.mux.Unlock()
@@ -173,7 +189,10 @@ func (dl *DownloadList) ClearTempFile(id string) {
 
 // DownloadPool 管理下载任务
 type DownloadPool struct {
+	mux    sync.Mutex
 	CtxMap map[string]context.CancelFunc
+	// 暂停的下载 取消后保留分片
+	Paused map[string]struct{}
 }
 
 var dp *DownloadPool
@@ -191,14 +210,60 @@ func GetDownloadPool() *DownloadPool {
 func NewDownloadPool() *DownloadPool {
 	return &DownloadPool{
 		CtxMap: make(map[string]context.CancelFunc),
+		Paused: make(map[string]struct{}),
 	}
 }
 
 func (d *DownloadPool) Add(id string, cancel context.CancelFunc) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
 	d.CtxMap[id] = cancel
+	delete(d.Paused, id)
+}
+
+// Remove 下载结束后移除
+func (d *DownloadPool) Remove(id string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	delete(d.CtxMap, id)
+	delete(d.Paused, id)
+}
+
+// Cancel 取消正在下载的任务 没有在下载时返回 false
+func (d *DownloadPool) Cancel(id string) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	cancelFunc, ok := d.CtxMap[id]
+	if ok {
+		cancelFunc()
+	}
+	return ok
+}
+
+// Pause 停止下载并标记为暂停 没有在下载时返回 false
+func (d *DownloadPool) Pause(id string) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	cancelFunc, ok := d.CtxMap[id]
+	if ok {
+		d.Paused[id] = struct{}{}
+		cancelFunc()
+	}
+	return ok
 }
 
-func (d *DownloadPool) Cancel(id string) {
-	cancelFunc := d.CtxMap[id]
-	cancelFunc()
+// Running 是否正在下载
+func (d *DownloadPool) Running(id string) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	_, ok := d.CtxMap[id]
+	return ok
+}
+
+// IsPaused 是否被暂停
+func (d *DownloadPool) IsPaused(id string) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	_, ok := d.Paused[id]
+	return ok
 }
@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var DownloadNotQueuedErr = errors.New("download is not queued")
+
+// 同时下载的任务数
+var defaultMaxActive = 3
+
+// DownloadQueueItem 队列快照中的一项
+type DownloadQueueItem struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Quality string `json:"quality"`
+	Size    string `json:"size"`
+	// 越大越先下载 相同时先加入的先下载
+	Priority int `json:"priority"`
+	// queued 或 downloading
+	State string `json:"state"`
+	// 等待的位置 从1开始 下载中为0
+	Position int `json:"position"`
+	// 秒
+	AddTime int64 `json:"add_time"`
+}
+
+type queueEntry struct {
+	ctx      context.Context
+	eld      ExtractLinkData
+	priority int
+	addTime  int64
+	done     chan error
+}
+
+// DownloadScheduler 下载队列 超过同时下载数的任务排队等待
+type DownloadScheduler struct {
+	mux       sync.Mutex
+	maxActive int
+	// 等待中的任务 按优先级和加入顺序排列
+	queue []*queueEntry
+	// 下载中的任务 按开始顺序排列
+	active []*queueEntry
+	run    func(ctx context.Context, eld ExtractLinkData) error
+
+	// 队列变化时调用 参数为新的快照
+	OnChange func(items []DownloadQueueItem)
+}
+
+var (
+	downloadScheduler     *DownloadScheduler
+	downloadSchedulerOnce sync.Once
+)
+
+// GetDownloadScheduler 全局下载队列 使用 Download 下载
+func GetDownloadScheduler() *DownloadScheduler {
+	downloadSchedulerOnce.Do(func() {
+		downloadScheduler = NewDownloadScheduler(defaultMaxActive, Download)
+	})
+	return downloadScheduler
+}
+
+// NewDownloadScheduler maxActive 小于等于0时使用默认值
+func NewDownloadScheduler(maxActive int, run func(ctx context.Context, eld ExtractLinkData) error) *DownloadScheduler {
+	if maxActive <= 0 {
+		maxActive = defaultMaxActive
+	}
+	return &DownloadScheduler{
+		maxActive: maxActive,
+		run:       run,
+	}
+}
+
+// Submit 加入队列 等到下载结束后返回下载的结果
+// 等待中被取消时返回 context.Canceled
+func (s *DownloadScheduler) Submit(ctx context.Context, eld ExtractLinkData) error {
+	entry := &queueEntry{
+		ctx:     ctx,
+		eld:     eld,
+		addTime: time.Now().Unix(),
+		done:    make(chan error, 1),
+	}
+	s.mux.Lock()
+	if s.find(eld.Id) != nil {
+		s.mux.Unlock()
+		return DownloadRunningErr
+	}
+	s.queue = append(s.queue, entry)
+	s.sortQueue()
+	s.schedule()
+	s.mux.Unlock()
+
+	s.changed()
+	return <-entry.done
+}
+
+// SetMaxActive 修改同时下载数 调大时立即开始等待中的任务 调小时不影响正在下载的任务
+func (s *DownloadScheduler) SetMaxActive(n int) {
+	if n <= 0 {
+		n = defaultMaxActive
+	}
+	s.mux.Lock()
+	s.maxActive = n
+	s.schedule()
+	s.mux.Unlock()
+	s.changed()
+}
+
+// SetPriority 修改等待中任务的优先级
+func (s *DownloadScheduler) SetPriority(id string, priority int) error {
+	s.mux.Lock()
+	index := s.queueIndex(id)
+	if index < 0 {
+		s.mux.Unlock()
+		return DownloadNotQueuedErr
+	}
+	s.queue[index].priority = priority
+	s.sortQueue()
+	s.mux.Unlock()
+	s.changed()
+	return nil
+}
+
+// MoveUp 和前一个等待中的任务交换位置 优先级不够时提高到和前一个相同
+func (s *DownloadScheduler) MoveUp(id string) error {
+	return s.move(id, -1)
+}
+
+// MoveDown 和后一个等待中的任务交换位置 优先级过高时降低到和后一个相同
+func (s *DownloadScheduler) MoveDown(id string) error {
+	return s.move(id, 1)
+}
+
+func (s *DownloadScheduler) move(id string, step int) error {
+	s.mux.Lock()
+	index := s.queueIndex(id)
+	if index < 0 {
+		s.mux.Unlock()
+		return DownloadNotQueuedErr
+	}
+	target := index + step
+	if target >= 0 && target < len(s.queue) {
+		// 交换后仍然按优先级排列
+		s.queue[index].priority = s.queue[target].priority
+		s.queue[index], s.queue[target] = s.queue[target], s.queue[index]
+	}
+	s.mux.Unlock()
+	s.changed()
+	return nil
+}
+
+// Remove 从等待队列中移除 等待的 Submit 返回 context.Canceled
+// 任务不在等待中时返回 false
+func (s *DownloadScheduler) Remove(id string) bool {
+	return s.remove(id, context.Canceled)
+}
+
+// Pause 从等待队列中移除 等待的 Submit 返回 DownloadPausedErr
+// 任务不在等待中时返回 false
+func (s *DownloadScheduler) Pause(id string) bool {
+	return s.remove(id, DownloadPausedErr)
+}
+
+func (s *DownloadScheduler) remove(id string, err error) bool {
+	s.mux.Lock()
+	index := s.queueIndex(id)
+	if index < 0 {
+		s.mux.Unlock()
+		return false
+	}
+	entry := s.queue[index]
+	s.queue = append(s.queue[:index], s.queue[index+1:]...)
+	s.mux.Unlock()
+
+	entry.done <- err
+	s.changed()
+	return true
+}
+
+// Contains 任务在下载中或等待中
+func (s *DownloadScheduler) Contains(id string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.find(id) != nil
+}
+
+// Snapshot 下载中的任务在前 等待中的任务按下载顺序在后
+func (s *DownloadScheduler) Snapshot() []DownloadQueueItem {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.snapshot()
+}
+
+func (s *DownloadScheduler) snapshot() []DownloadQueueItem {
+	items := make([]DownloadQueueItem, 0, len(s.active)+len(s.queue))
+	for _, entry := range s.active {
+		items = append(items, entry.item(DownloadStateDownloading, 0))
+	}
+	for i, entry := range s.queue {
+		items = append(items, entry.item(DownloadStateQueued, i+1))
+	}
+	return items
+}
+
+// schedule 有空位时按顺序开始等待中的任务 调用时需要持有锁
+func (s *DownloadScheduler) schedule() {
+	for len(s.active) < s.maxActive && len(s.queue) > 0 {
+		entry := s.queue[0]
+		s.queue = s.queue[1:]
+		s.active = append(s.active, entry)
+		go s.execute(entry)
+	}
+}
+
+func (s *DownloadScheduler) execute(entry *queueEntry) {
+	err := s.run(entry.ctx, entry.eld)
+
+	s.mux.Lock()
+	for i, e := range s.active {
+		if e == entry {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+	s.schedule()
+	s.mux.Unlock()
+
+	entry.done <- err
+	s.changed()
+}
+
+func (s *DownloadScheduler) changed() {
+	if s.OnChange == nil {
+		return
+	}
+	s.OnChange(s.Snapshot())
+}
+
+func (s *DownloadScheduler) sortQueue() {
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		return s.queue[i].priority > s.queue[j].priority
+	})
+}
+
+func (s *DownloadScheduler) queueIndex(id string) int {
+	for i, entry := range s.queue {
+		if entry.eld.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *DownloadScheduler) find(id string) *queueEntry {
+	for _, entry := range s.active {
+		if entry.eld.Id == id {
+			return entry
+		}
+	}
+	if index := s.queueIndex(id); index >= 0 {
+		return s.queue[index]
+	}
+	return nil
+}
+
+func (e *queueEntry) item(state string, position int) DownloadQueueItem {
+	return DownloadQueueItem{
+		ID:       e.eld.Id,
+		Title:    e.eld.Title,
+		Quality:  e.eld.Quality,
+		Size:     e.eld.Size,
+		Priority: e.priority,
+		State:    state,
+		Position: position,
+		AddTime:  e.addTime,
+	}
+}
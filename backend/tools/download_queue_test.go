@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadScheduler(t *testing.T) {
+	var (
+		mux     sync.Mutex
+		started []string
+		release = make(map[string]chan error)
+	)
+	for i := 1; i <= 6; i++ {
+		release[fmt.Sprint(i)] = make(chan error, 1)
+	}
+	scheduler := NewDownloadScheduler(2, func(ctx context.Context, eld ExtractLinkData) error {
+		mux.Lock()
+		started = append(started, eld.Id)
+		mux.Unlock()
+		return <-release[eld.Id]
+	})
+	changes := make(chan []DownloadQueueItem, 100)
+	scheduler.OnChange = func(items []DownloadQueueItem) {
+		changes <- items
+	}
+
+	results := make(map[string]chan error)
+	submit := func(id string) {
+		results[id] = make(chan error, 1)
+		go func() {
+			results[id] <- scheduler.Submit(context.Background(), ExtractLinkData{Id: id, Title: "video " + id})
+		}()
+		// 等待加入队列 保证加入顺序
+		for {
+			for _, item := range scheduler.Snapshot() {
+				if item.ID == id {
+					return
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	order := func() []string {
+		ids := make([]string, 0)
+		for _, item := range scheduler.Snapshot() {
+			ids = append(ids, fmt.Sprintf("%s:%s", item.ID, item.State))
+		}
+		return ids
+	}
+	for i := 1; i <= 5; i++ {
+		submit(fmt.Sprint(i))
+	}
+	if got, want := order(), []string{"1:downloading", "2:downloading", "3:queued", "4:queued", "5:queued"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if len(changes) == 0 {
+		t.Fatal("expected queue change events")
+	}
+	if err := scheduler.Submit(context.Background(), ExtractLinkData{Id: "3"}); !errors.Is(err, DownloadRunningErr) {
+		t.Fatalf("expected DownloadRunningErr, got %v", err)
+	}
+
+	// 5 提高优先级排到最前 4 上移后在 3 前面
+	if err := scheduler.SetPriority("5", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.MoveDown("3"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(), []string{"1:downloading", "2:downloading", "5:queued", "4:queued", "3:queued"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if err := scheduler.MoveUp("4"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(), []string{"1:downloading", "2:downloading", "4:queued", "5:queued", "3:queued"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if err := scheduler.MoveUp("1"); !errors.Is(err, DownloadNotQueuedErr) {
+		t.Fatalf("expected DownloadNotQueuedErr, got %v", err)
+	}
+
+	// 移出队列的任务返回取消
+	if !scheduler.Remove("5") {
+		t.Fatal("expected removed")
+	}
+	if err := <-results["5"]; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// 暂停等待中的任务 下载中的任务不在等待队列
+	submit("6")
+	if !scheduler.Pause("6") || scheduler.Pause("1") {
+		t.Fatal("expected only queued download to be paused")
+	}
+	if err := <-results["6"]; !errors.Is(err, DownloadPausedErr) {
+		t.Fatalf("expected DownloadPausedErr, got %v", err)
+	}
+
+	// 结束一个后开始下一个
+	failed := errors.New("failed")
+	release["1"] <- failed
+	if err := <-results["1"]; !errors.Is(err, failed) {
+		t.Fatalf("expected failed, got %v", err)
+	}
+	waitStarted(t, &mux, &started, []string{"1", "2", "4"})
+
+	// 调大同时下载数立即开始等待中的任务
+	scheduler.SetMaxActive(3)
+	waitStarted(t, &mux, &started, []string{"1", "2", "4", "3"})
+
+	for _, id := range []string{"2", "3", "4"} {
+		release[id] <- nil
+		if err := <-results[id]; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items := scheduler.Snapshot(); len(items) != 0 {
+		t.Fatalf("expected empty queue, got %+v", items)
+	}
+}
+
+func startedIDs(mux *sync.Mutex, started *[]string) []string {
+	mux.Lock()
+	defer mux.Unlock()
+	return append([]string{}, *started...)
+}
+
+func waitStarted(t *testing.T, mux *sync.Mutex, started *[]string, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(startedIDs(mux, started), want) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected started %v, got %v", want, startedIDs(mux, started))
+}
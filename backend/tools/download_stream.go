@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"github.com/wanyuqin/lux/extractors"
+	"github.com/wanyuqin/tool-collection/configs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// 1080P 1080p60
+	streamHeightRegexp = regexp.MustCompile(`(\d{3,4})[pP]`)
+	// 1920x1080
+	streamSizeRegexp = regexp.MustCompile(`\d{3,4}[xX](\d{3,4})`)
+	// 4K 超清
+	streamKRegexp = regexp.MustCompile(`([248])[kK]`)
+)
+
+// SelectStream 按规则选择清晰度 返回流的ID 没有流时返回空
+// best 最大的 smallest 最小的 best:1080 不超过1080p的最大的
+// 没有可以识别分辨率且不超过限制的流时 和 best 一样选择最大的
+func SelectStream(streams map[string]*extractors.Stream, rule string) string {
+	ids := sortedStreamIDs(streams)
+	if len(ids) == 0 {
+		return ""
+	}
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if rule == configs.StreamSmallest {
+		return ids[len(ids)-1]
+	}
+	limit, ok := strings.CutPrefix(rule, configs.StreamBest+":")
+	if !ok {
+		return ids[0]
+	}
+	maxHeight, err := strconv.Atoi(strings.TrimSuffix(limit, "p"))
+	if err != nil || maxHeight <= 0 {
+		return ids[0]
+	}
+	for _, id := range ids {
+		if height := streamHeight(streams[id].Quality); height > 0 && height <= maxHeight {
+			return id
+		}
+	}
+	return ids[0]
+}
+
+// sortedStreamIDs 按大小倒序 大小相同时按ID排序
+func sortedStreamIDs(streams map[string]*extractors.Stream) []string {
+	ids := make([]string, 0, len(streams))
+	for id := range streams {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if streams[ids[i]].Size != streams[ids[j]].Size {
+			return streams[ids[i]].Size > streams[ids[j]].Size
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// streamHeight 从清晰度名称中识别分辨率的高度 无法识别时返回0
+func streamHeight(quality string) int {
+	if match := streamSizeRegexp.FindStringSubmatch(quality); match != nil {
+		height, _ := strconv.Atoi(match[1])
+		return height
+	}
+	if match := streamHeightRegexp.FindStringSubmatch(quality); match != nil {
+		height, _ := strconv.Atoi(match[1])
+		return height
+	}
+	if match := streamKRegexp.FindStringSubmatch(quality); match != nil {
+		switch match[1] {
+		case "2":
+			return 1440
+		case "4":
+			return 2160
+		case "8":
+			return 4320
+		}
+	}
+	return 0
+}
+
+// resolveStream 按选择的清晰度更新大小和清晰度名称 未选择时按设置选择
+func resolveStream(eld ExtractLinkData, data *extractors.Data, rule string) (ExtractLinkData, error) {
+	if eld.Stream == "" {
+		eld.Stream = SelectStream(data.Streams, rule)
+	}
+	stream, ok := data.Streams[eld.Stream]
+	if !ok {
+		return eld, StreamNotFoundErr
+	}
+	streamInfo := GetStreamInfo(stream)
+	eld.Quality = streamInfo.Quality
+	eld.Size = streamInfo.Size
+	eld.Byte = streamInfo.Byte
+	return eld, nil
+}
@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"errors"
+	"github.com/wanyuqin/lux/extractors"
+	"reflect"
+	"testing"
+)
+
+func TestStreamHeight(t *testing.T) {
+	tests := map[string]int{
+		"高清 1080P":                    1080,
+		"高清 1080P60":                  1080,
+		"清晰 480P":                     480,
+		"超清 4K":                       2160,
+		"1920x1080 video/mp4":         1080,
+		"720p60 video/webm; codecs=1": 720,
+		"audio/mp4":                   0,
+		"":                            0,
+	}
+	for quality, want := range tests {
+		if got := streamHeight(quality); got != want {
+			t.Errorf("%q: expected %d, got %d", quality, want, got)
+		}
+	}
+}
+
+func TestSelectStream(t *testing.T) {
+	streams := map[string]*extractors.Stream{
+		"120": {Quality: "超清 4K", Size: 4000, Ext: "flv"},
+		"80":  {Quality: "高清 1080P", Size: 2000, Ext: "flv"},
+		"64":  {Quality: "高清 720P", Size: 1000, Ext: "flv"},
+		"32":  {Quality: "清晰 480P", Size: 500, Ext: "flv"},
+	}
+	tests := map[string]string{
+		"":          "120",
+		"best":      "120",
+		"smallest":  "32",
+		"best:1080": "80",
+		"best:720p": "64",
+		"BEST:1440": "80",
+		// 没有不超过限制的清晰度时和 best 一样
+		"best:360": "120",
+		"best:abc": "120",
+	}
+	for rule, want := range tests {
+		if got := SelectStream(streams, rule); got != want {
+			t.Errorf("%q: expected %s, got %s", rule, want, got)
+		}
+	}
+	// 清晰度名称中没有分辨率
+	unlabeled := map[string]*extractors.Stream{
+		"hd": {Quality: "video/mp4", Size: 2000},
+		"sd": {Quality: "video/mp4", Size: 1000},
+	}
+	if got := SelectStream(unlabeled, "best:1080"); got != "hd" {
+		t.Errorf("expected hd for unlabeled streams, got %s", got)
+	}
+	if got := SelectStream(nil, "best"); got != "" {
+		t.Errorf("expected empty stream, got %s", got)
+	}
+}
+
+func TestNewExtractLinkData(t *testing.T) {
+	item := &extractors.Data{
+		Title: "video",
+		URL:   "https://www.bilibili.com/video/BV1",
+		Type:  extractors.DataTypeVideo,
+		Streams: map[string]*extractors.Stream{
+			"80": {Quality: "高清 1080P", Size: 2 * 1024 * 1024, Ext: "mp4", NeedMux: true},
+			"16": {Quality: "流畅 360P", Size: 1024 * 1024, Ext: "flv"},
+		},
+	}
+	eld, err := newExtractLinkData("1", item, "", "smallest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StreamInfo{
+		{ID: "80", Quality: "高清 1080P", Size: "2.00 MiB", Byte: 2 * 1024 * 1024, Ext: "mp4", NeedMux: true},
+		{ID: "16", Quality: "流畅 360P", Size: "1.00 MiB", Byte: 1024 * 1024, Ext: "flv"},
+	}
+	if !reflect.DeepEqual(eld.Streams, want) {
+		t.Fatalf("expected %+v, got %+v", want, eld.Streams)
+	}
+	if eld.Stream != "16" || eld.Quality != "流畅 360P" || eld.Byte != 1024*1024 {
+		t.Fatalf("expected smallest stream selected, got %+v", eld)
+	}
+
+	// 继续下载时使用原来的清晰度 不存在时按规则选择
+	if eld, _ = newExtractLinkData("1", item, "80", "smallest"); eld.Stream != "80" {
+		t.Fatalf("expected stream 80, got %s", eld.Stream)
+	}
+	if eld, _ = newExtractLinkData("1", item, "120", "best"); eld.Stream != "80" {
+		t.Fatalf("expected stream 80, got %s", eld.Stream)
+	}
+
+	// 选择的清晰度更新大小
+	eld.Stream = "16"
+	if eld, err = resolveStream(eld, item, "best"); err != nil || eld.Byte != 1024*1024 {
+		t.Fatalf("unexpected %+v %v", eld, err)
+	}
+	eld.Stream = "120"
+	if _, err = resolveStream(eld, item, "best"); !errors.Is(err, StreamNotFoundErr) {
+		t.Fatalf("expected StreamNotFoundErr, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var DownloadTaskNotFoundErr = errors.New("download task not found")
+
+// DefaultDownloadTaskName 未完成的下载 放在 ~/.tools_collection 下
+var DefaultDownloadTaskName = "download_tasks.json"
+
+// DownloadTask 开始下载后保存 下载结束时删除 程序退出后留下的就是没有完成的下载
+type DownloadTask struct {
+	ID string `json:"id"`
+	// 解析前的网页地址
+	Url   string `json:"url"`
+	Title string `json:"title"`
+	// 选择的清晰度
+	Stream  string `json:"stream"`
+	Quality string `json:"quality"`
+	Size    int64  `json:"size"`
+	Output  string `json:"output"`
+	// 分片文件路径 下载中的分片带 .download 后缀
+	Parts []string `json:"parts"`
+	// 秒
+	AddTime int64 `json:"add_time"`
+}
+
+// DownloadTaskStore 下载任务 按加入顺序保存 每次修改重写整个文件
+type DownloadTaskStore struct {
+	mux   sync.RWMutex
+	path  string
+	tasks []DownloadTask
+}
+
+var (
+	downloadTaskStore     *DownloadTaskStore
+	downloadTaskStoreOnce sync.Once
+)
+
+// GetDownloadTaskStore 默认位置的下载任务 读取失败时只保存在内存中
+func GetDownloadTaskStore() *DownloadTaskStore {
+	downloadTaskStoreOnce.Do(func() {
+		var err error
+		if downloadTaskStore, err = OpenDownloadTaskStore(""); err != nil {
+			logger.Error(fmt.Sprintf("open download tasks failed: %v", err))
+			downloadTaskStore = &DownloadTaskStore{}
+		}
+	})
+	return downloadTaskStore
+}
+
+// OpenDownloadTaskStore path 为空时使用 ~/.tools_collection/download_tasks.json
+func OpenDownloadTaskStore(path string) (*DownloadTaskStore, error) {
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(homeDir, ".tools_collection", DefaultDownloadTaskName)
+	}
+	s := &DownloadTaskStore{path: path}
+	body, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &s.tasks); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save 新增或更新任务 更新时位置不变
+func (s *DownloadTaskStore) Save(task DownloadTask) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i := range s.tasks {
+		if s.tasks[i].ID == task.ID {
+			s.tasks[i] = task
+			return s.flush()
+		}
+	}
+	s.tasks = append(s.tasks, task)
+	return s.flush()
+}
+
+// Get 按ID获取任务
+func (s *DownloadTaskStore) Get(id string) (DownloadTask, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for _, task := range s.tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return DownloadTask{}, DownloadTaskNotFoundErr
+}
+
+// List 按加入顺序返回全部任务
+func (s *DownloadTaskStore) List() []DownloadTask {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	tasks := make([]DownloadTask, len(s.tasks))
+	copy(tasks, s.tasks)
+	return tasks
+}
+
+// Remove 删除任务 不删除分片文件
+func (s *DownloadTaskStore) Remove(ids ...string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.remove(ids)
+}
+
+// Discard 删除任务和已下载的分片文件
+func (s *DownloadTaskStore) Discard(ids ...string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var errs []error
+	for _, task := range s.tasks {
+		if !containsString(ids, task.ID) {
+			continue
+		}
+		for _, part := range task.Parts {
+			for _, path := range []string{part, part + ".download"} {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if err := s.remove(ids); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *DownloadTaskStore) remove(ids []string) error {
+	tasks := s.tasks[:0]
+	for _, task := range s.tasks {
+		if !containsString(ids, task.ID) {
+			tasks = append(tasks, task)
+		}
+	}
+	if len(tasks) == len(s.tasks) {
+		return nil
+	}
+	s.tasks = tasks
+	return s.flush()
+}
+
+// flush 先写临时文件再替换 避免退出时写坏
+func (s *DownloadTaskStore) flush() error {
+	if s.path == "" {
+		return nil
+	}
+	body, err := json.Marshal(s.tasks)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, body, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
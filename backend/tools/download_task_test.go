@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"github.com/wanyuqin/lux/extractors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownloadTaskStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultDownloadTaskName)
+	store, err := OpenDownloadTaskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []string{filepath.Join(dir, "video[0].mp4"), filepath.Join(dir, "video[1].mp4")}
+	tasks := []DownloadTask{
+		{ID: "1", Url: "https://www.bilibili.com/video/BV1", Title: "video", Stream: "80", Parts: parts, AddTime: 100},
+		{ID: "2", Url: "https://www.bilibili.com/video/BV2", Title: "other", Stream: "64", AddTime: 200},
+		{ID: "3", Url: "https://www.bilibili.com/video/BV3", Title: "third", Stream: "32", AddTime: 300},
+	}
+	for _, task := range tasks {
+		if err = store.Save(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 更新时位置不变
+	tasks[0].Output = filepath.Join(dir, "video.mp4")
+	if err = store.Save(tasks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Remove("2", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenDownloadTaskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.List(), []DownloadTask{tasks[0], tasks[2]}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if _, err = store.Get("2"); !errors.Is(err, DownloadTaskNotFoundErr) {
+		t.Fatalf("expected DownloadTaskNotFoundErr, got %v", err)
+	}
+
+	// 放弃时删除已下载完和下载中的分片
+	if err = os.WriteFile(parts[0], []byte("done"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(parts[1]+".download", []byte("half"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Discard("1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{parts[0], parts[1] + ".download"} {
+		if _, err = os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, got %v", p, err)
+		}
+	}
+	if got := store.List(); len(got) != 1 || got[0].ID != "3" {
+		t.Fatalf("unexpected tasks %+v", got)
+	}
+}
+
+func TestTaskLinkData(t *testing.T) {
+	data := []*extractors.Data{{
+		Title: "video",
+		URL:   "https://www.bilibili.com/video/BV1",
+		Streams: map[string]*extractors.Stream{
+			"64": {Quality: "高清 720P", Size: 1000},
+			"32": {Quality: "清晰 480P", Size: 500},
+		},
+	}}
+	task := DownloadTask{ID: "1", Title: "video", Stream: "64", Parts: []string{"video[0].mp4"}}
+	eld, item, err := taskLinkData(task, data, "smallest")
+	if err != nil || eld.Stream != "64" || item != data[0] {
+		t.Fatalf("expected stream 64, got %+v %v", eld, err)
+	}
+
+	// 原来的清晰度不存在时不能换成其他清晰度继续
+	task.Stream = "80"
+	if _, _, err = taskLinkData(task, data, "smallest"); !errors.Is(err, StreamNotFoundErr) {
+		t.Fatalf("expected StreamNotFoundErr, got %v", err)
+	}
+	// 还没有分片时按设置选择
+	task.Parts = nil
+	if eld, _, err = taskLinkData(task, data, "smallest"); err != nil || eld.Stream != "32" {
+		t.Fatalf("expected stream 32, got %+v %v", eld, err)
+	}
+}
+
+func TestUnfinishedTasks(t *testing.T) {
+	release := make(chan error)
+	scheduler := NewDownloadScheduler(1, func(ctx context.Context, eld ExtractLinkData) error {
+		return <-release
+	})
+	results := make(chan error, 2)
+	for _, id := range []string{"1", "2"} {
+		id := id
+		go func() {
+			results <- scheduler.Submit(context.Background(), ExtractLinkData{Id: id})
+		}()
+		for !scheduler.Contains(id) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 1 下载中 2 排队中
+	tasks := []DownloadTask{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	got := unfinishedTasks(tasks, scheduler)
+	if len(got) != 1 || got[0].ID != "3" {
+		t.Fatalf("expected only task 3, got %+v", got)
+	}
+
+	for range tasks[:2] {
+		release <- nil
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package tools
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/wanyuqin/lux/extractors"
 	"github.com/wanyuqin/lux/extractors/acfun"
 	"github.com/wanyuqin/lux/extractors/bcy"
@@ -13,7 +16,12 @@ import (
 	"github.com/wanyuqin/lux/extractors/youtube"
 	"github.com/wanyuqin/tool-collection/logger"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func setUp() {
@@ -51,3 +59,124 @@ func TestExtractLink(t *testing.T) {
 	}
 
 }
+
+func TestWriteFilePauseResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	half := len(content) / 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start:])
+			return
+		}
+		// 第一次请求只返回一半 等待客户端暂停
+		w.Write(content[:half])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "video[0].mp4.download")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			if info, err := os.Stat(path); err == nil && info.Size() == int64(half) {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	written, _, err := writeFile(ctx, server.URL, file, map[string]string{})
+	if !errors.Is(err, context.Canceled) || written != int64(half) {
+		t.Fatalf("expected %d bytes and context canceled, got %d %v", half, written, err)
+	}
+
+	written, start, err := writeFile(context.Background(), server.URL, file, map[string]string{
+		"Range": fmt.Sprintf("bytes=%d-", half),
+	})
+	if err != nil || written != int64(len(content)-half) || start != int64(half) {
+		t.Fatalf("resume failed: %d %d %v", written, start, err)
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Fatalf("unexpected content after resume")
+	}
+}
+
+func TestWriteFileRangeIgnored(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	half := len(content) / 2
+	tests := map[string]http.HandlerFunc{
+		// 不支持 Range 返回完整内容
+		"ignored": func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		},
+		// 返回的起始位置不对
+		"mismatch": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") == "" {
+				w.Write(content)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content)
+		},
+	}
+	for name, handler := range tests {
+		server := httptest.NewServer(handler)
+		path := filepath.Join(t.TempDir(), "video[0].mp4.download")
+		if err := os.WriteFile(path, content[:half], 0644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written, start, err := writeFile(context.Background(), server.URL, file, map[string]string{
+			"Range": fmt.Sprintf("bytes=%d-", half),
+		})
+		file.Close()
+		server.Close()
+		if err != nil || start != 0 || written != int64(len(content)) {
+			t.Fatalf("%s: expected restart from 0, got %d %d %v", name, written, start, err)
+		}
+		if body, _ := os.ReadFile(path); !bytes.Equal(body, content) {
+			t.Fatalf("%s: unexpected content", name)
+		}
+	}
+}
+
+func TestDownloadPoolPause(t *testing.T) {
+	pool := NewDownloadPool()
+	if pool.Pause("1") || pool.Cancel("1") {
+		t.Fatal("expected no running download")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Add("1", cancel)
+	if !pool.Running("1") || !pool.Pause("1") || !pool.IsPaused("1") || ctx.Err() == nil {
+		t.Fatal("expected download paused")
+	}
+	pool.Remove("1")
+	if pool.Running("1") || pool.IsPaused("1") {
+		t.Fatal("expected download removed")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	pool.Add("2", cancel)
+	if !pool.Cancel("2") || pool.IsPaused("2") || ctx.Err() == nil {
+		t.Fatal("expected download canceled")
+	}
+}
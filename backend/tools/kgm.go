@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	KgmHeaderErr = errors.New("kgm header is invalid")
+	KgmMaskErr   = errors.New("kgm mask table file is missing or invalid")
+)
+
+// DefaultKgmMaskName 生成酷狗密钥流的常量表 放在 ~/.tools_collection 下
+// 依次为 table1 table2 maskV2PreDef 各272字节
+var DefaultKgmMaskName = "kgm.mask"
+
+// kgmTableSize 每个常量表的长度
+const kgmTableSize = 272
+
+var (
+	kgmHeader = []byte{0x7c, 0xd5, 0x32, 0xeb, 0x86, 0x02, 0x7f, 0x4b, 0xa8, 0xaf, 0xa6, 0x8e, 0x0f, 0xff, 0x99, 0x14}
+	vprHeader = []byte{0x05, 0x28, 0xbc, 0x96, 0xe9, 0xe4, 0x5a, 0x43, 0x91, 0xaa, 0xbd, 0xd0, 0x7a, 0xf5, 0x36, 0x31}
+	vprKey    = []byte{0x25, 0xdf, 0xe8, 0xa6, 0x75, 0x1e, 0x75, 0x0e, 0x2f, 0x80, 0xf3, 0x2d, 0xb8, 0xb6, 0xe3, 0x11, 0x00}
+)
+
+// kgmDecryptor 酷狗音乐 .kgm .vpr
+// 密钥流和文件无关 由三个常量表按位置计算 见 kgmMaskTable.mask
+type kgmDecryptor struct {
+	maskPath string
+}
+
+// NewKgmDecryptor maskPath 为常量表文件 为空时使用 ~/.tools_collection/kgm.mask
+func NewKgmDecryptor(maskPath string) Decryptor {
+	return &kgmDecryptor{maskPath: maskPath}
+}
+
+func (d *kgmDecryptor) Name() string {
+	return "kgm"
+}
+
+func (d *kgmDecryptor) Extensions() []string {
+	return []string{".kgm", ".kgma", ".vpr"}
+}
+
+func (d *kgmDecryptor) Match(header []byte) bool {
+	return bytes.HasPrefix(header, kgmHeader) || bytes.HasPrefix(header, vprHeader)
+}
+
+func (d *kgmDecryptor) Open(r io.ReadSeeker, name string) (DecryptedAudio, error) {
+	header := make([]byte, 0x2c)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", KgmHeaderErr, err)
+	}
+	if !d.Match(header) {
+		return nil, KgmHeaderErr
+	}
+
+	headerLen := int64(binary.LittleEndian.Uint32(header[0x10:]))
+	size, err := seekSize(r)
+	if err != nil {
+		return nil, err
+	}
+	if headerLen < int64(len(header)) || headerLen > size {
+		return nil, fmt.Errorf("%w: bad header length %d", KgmHeaderErr, headerLen)
+	}
+	if _, err = r.Seek(headerLen, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	mask, err := d.loadMask()
+	if err != nil {
+		return nil, err
+	}
+	audioSize := size - headerLen
+
+	cipher := &kgmCipher{
+		key:  append(append([]byte{}, header[0x1c:0x2c]...), 0),
+		mask: mask,
+		vpr:  bytes.HasPrefix(header, vprHeader) || strings.EqualFold(filepath.Ext(name), ".vpr"),
+	}
+	return &decryptedStream{
+		Reader: newCipherReader(r, cipher),
+		size:   audioSize,
+	}, nil
+}
+
+func (d *kgmDecryptor) loadMask() (*kgmMaskTable, error) {
+	path := d.maskPath
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(homeDir, ".tools_collection", DefaultKgmMaskName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", KgmMaskErr, err)
+	}
+	return newKgmMaskTable(data)
+}
+
+// kgmMaskTable 生成密钥流的常量表
+type kgmMaskTable struct {
+	table1 [kgmTableSize]byte
+	table2 [kgmTableSize]byte
+	preDef [kgmTableSize]byte
+}
+
+func newKgmMaskTable(data []byte) (*kgmMaskTable, error) {
+	if len(data) != kgmTableSize*3 {
+		return nil, fmt.Errorf("%w: need %d bytes, got %d", KgmMaskErr, kgmTableSize*3, len(data))
+	}
+	t := &kgmMaskTable{}
+	copy(t.table1[:], data)
+	copy(t.table2[:], data[kgmTableSize:])
+	copy(t.preDef[:], data[kgmTableSize*2:])
+	return t, nil
+}
+
+// mask 位置 pos 的密钥流 每16字节共用一个由 table1 table2 交替异或出的值
+func (t *kgmMaskTable) mask(pos int64) byte {
+	offset := pos >> 4
+	var value byte
+	for offset >= 0x11 {
+		value ^= t.table1[offset%kgmTableSize]
+		offset >>= 4
+		value ^= t.table2[offset%kgmTableSize]
+		offset >>= 4
+	}
+	return t.preDef[pos%kgmTableSize] ^ value
+}
+
+// kgmCipher 文件密钥(17字节)与密钥流共同作用
+type kgmCipher struct {
+	key  []byte
+	mask *kgmMaskTable
+	vpr  bool
+}
+
+func (c *kgmCipher) Decrypt(buf []byte, offset int64) {
+	for i := range buf {
+		pos := offset + int64(i)
+		med := c.key[pos%17] ^ buf[i]
+		med ^= (med & 0xf) << 4
+
+		msk := c.mask.mask(pos)
+		msk ^= (msk & 0xf) << 4
+		buf[i] = med ^ msk
+
+		if c.vpr {
+			buf[i] ^= vprKey[pos%17]
+		}
+	}
+}
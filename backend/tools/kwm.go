@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var KwmHeaderErr = errors.New("kwm header is invalid")
+
+const (
+	kwmAudioOffset   = 0x400
+	kwmPreDefinedKey = "MoOtOiTvINGwd2E6n0E1i7L5t2IoOoNk"
+)
+
+// kwmDecryptor 酷我音乐 .kwm
+type kwmDecryptor struct {
+}
+
+func NewKwmDecryptor() Decryptor {
+	return &kwmDecryptor{}
+}
+
+func (d *kwmDecryptor) Name() string {
+	return "kwm"
+}
+
+func (d *kwmDecryptor) Extensions() []string {
+	return []string{".kwm"}
+}
+
+func (d *kwmDecryptor) Match(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("yeelion-kuwo"))
+}
+
+func (d *kwmDecryptor) Open(r io.ReadSeeker, name string) (DecryptedAudio, error) {
+	header := make([]byte, kwmAudioOffset)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", KwmHeaderErr, err)
+	}
+	if !d.Match(header) {
+		return nil, KwmHeaderErr
+	}
+
+	size, err := seekSize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptedStream{
+		Reader: newCipherReader(r, newKwmCipher(header[0x18:0x20])),
+		size:   size - kwmAudioOffset,
+		format: kwmFormat(header[0x30:0x38]),
+	}, nil
+}
+
+// kwmFormat 文件头中记录了码率和格式 如 "320MP3" "2000FLAC"
+func kwmFormat(raw []byte) string {
+	s := strings.TrimRight(string(raw), "\x00")
+	s = strings.TrimLeftFunc(s, unicode.IsDigit)
+	return strings.ToLower(s)
+}
+
+// kwmCipher 32字节循环的密钥流
+type kwmCipher struct {
+	mask [32]byte
+}
+
+func newKwmCipher(key []byte) *kwmCipher {
+	keyStr := strconv.FormatUint(binary.LittleEndian.Uint64(key), 10)
+	c := &kwmCipher{}
+	for i := range c.mask {
+		c.mask[i] = kwmPreDefinedKey[i] ^ keyStr[i%len(keyStr)]
+	}
+	return c
+}
+
+func (c *kwmCipher) Decrypt(buf []byte, offset int64) {
+	for i := range buf {
+		buf[i] ^= c.mask[(offset+int64(i))&0x1f]
+	}
+}
@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/bogem/id3v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 与源文件同名的歌词文件 翻译歌词为 .tlrc
+var (
+	lyricsExt           = ".lrc"
+	translatedLyricsExt = ".tlrc"
+)
+
+// lrcTimeTag [mm:ss] [mm:ss.xx] [mm:ss:xx]
+var lrcTimeTag = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// LyricsLine 一行带时间的歌词
+type LyricsLine struct {
+	Time time.Duration
+	Text string
+}
+
+// Lyrics 歌词 Text 为合并翻译后的LRC文本, Lines 为带时间的行 没有时间标签时为空
+type Lyrics struct {
+	Text  string
+	Lines []LyricsLine
+}
+
+// LoadSidecarLyrics 读取源文件同目录下的 <basename>.lrc 和 <basename>.tlrc 没有歌词时返回nil
+func LoadSidecarLyrics(input string) (*Lyrics, error) {
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+	text, err := readLyricsFile(base + lyricsExt)
+	if err != nil || text == "" {
+		return nil, err
+	}
+	translated, err := readLyricsFile(base + translatedLyricsExt)
+	if err != nil {
+		return nil, err
+	}
+	return newLyrics(text, translated), nil
+}
+
+func readLyricsFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	text, err := decodeLyricsText(data)
+	if err != nil {
+		return "", fmt.Errorf("decode %s failed: %w", filepath.Base(path), err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// decodeLyricsText 识别 BOM UTF-8 和 GBK 编码
+func decodeLyricsText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return string(data[3:]), nil
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return decodeUTF16(data[2:], binary.LittleEndian), nil
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return decodeUTF16(data[2:], binary.BigEndian), nil
+	case utf8.Valid(data):
+		return string(data), nil
+	}
+	// GB18030 兼容 GBK
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// newLyrics 翻译歌词按时间插入到原文之后
+func newLyrics(text, translated string) *Lyrics {
+	lines := parseLrc(text)
+	if len(lines) == 0 {
+		return &Lyrics{Text: text}
+	}
+
+	translations := make(map[time.Duration]string)
+	for _, line := range parseLrc(translated) {
+		if line.Text != "" {
+			translations[line.Time] = line.Text
+		}
+	}
+	merged := make([]LyricsLine, 0, len(lines)+len(translations))
+	for _, line := range lines {
+		merged = append(merged, line)
+		if t, ok := translations[line.Time]; ok && line.Text != "" && t != line.Text {
+			merged = append(merged, LyricsLine{Time: line.Time, Text: t})
+		}
+	}
+
+	buf := &strings.Builder{}
+	for i, line := range merged {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(formatLrcTime(line.Time))
+		buf.WriteString(line.Text)
+	}
+	return &Lyrics{Text: buf.String(), Lines: merged}
+}
+
+// parseLrc 解析带时间标签的行 一行可以有多个时间标签 忽略 [ar:] 等信息标签
+func parseLrc(text string) []LyricsLine {
+	lines := make([]LyricsLine, 0)
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimSpace(raw)
+		times := make([]time.Duration, 0, 1)
+		for {
+			m := lrcTimeTag.FindStringSubmatch(raw)
+			if m == nil {
+				break
+			}
+			minutes, _ := strconv.Atoi(m[1])
+			seconds, _ := strconv.Atoi(m[2])
+			t := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+			if m[3] != "" {
+				// 小数部分 .5 .50 .500 都是500毫秒
+				fraction, _ := strconv.Atoi((m[3] + "00")[:3])
+				t += time.Duration(fraction) * time.Millisecond
+			}
+			times = append(times, t)
+			raw = raw[len(m[0]):]
+		}
+		for _, t := range times {
+			lines = append(lines, LyricsLine{Time: t, Text: strings.TrimSpace(raw)})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+	return lines
+}
+
+func formatLrcTime(t time.Duration) string {
+	ms := t.Milliseconds()
+	return fmt.Sprintf("[%02d:%02d.%02d]", ms/60000, ms/1000%60, ms%1000/10)
+}
+
+// syltFrame 同步歌词帧 id3v2 没有提供 时间单位为毫秒
+// Encoding 需要用 id3Encoding 按标签版本选择
+type syltFrame struct {
+	Encoding id3v2.Encoding
+	Language string
+	Lines    []LyricsLine
+}
+
+func (f syltFrame) Size() int {
+	// 编码 语言 时间格式 内容类型 空描述
+	size := 1 + 3 + 1 + 1 + len(f.Encoding.TerminationBytes)
+	for _, line := range f.Lines {
+		size += len(f.encodeText(line.Text)) + 4
+	}
+	return size
+}
+
+// encodeText 按帧的编码转换文本 包含结束符
+func (f syltFrame) encodeText(text string) []byte {
+	if !f.Encoding.Equals(id3v2.EncodingUTF16) {
+		return append([]byte(text), 0x00)
+	}
+	// 每段文本都以小端序BOM开头
+	units := utf16.Encode([]rune(text))
+	data := make([]byte, 0, 2+len(units)*2+2)
+	data = append(data, 0xff, 0xfe)
+	for _, u := range units {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return append(data, 0x00, 0x00)
+}
+
+func (f syltFrame) UniqueIdentifier() string {
+	return f.Language
+}
+
+func (f syltFrame) WriteTo(w io.Writer) (int64, error) {
+	if len(f.Language) != 3 {
+		return 0, id3v2.ErrInvalidLanguageLength
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, f.Size()))
+	buf.WriteByte(f.Encoding.Key)
+	buf.WriteString(f.Language)
+	// 2 表示毫秒 1 表示歌词
+	buf.Write([]byte{0x02, 0x01})
+	buf.Write(f.Encoding.TerminationBytes)
+	var ts [4]byte
+	for _, line := range f.Lines {
+		buf.Write(f.encodeText(line.Text))
+		binary.BigEndian.PutUint32(ts[:], uint32(line.Time.Milliseconds()))
+		buf.Write(ts[:])
+	}
+	return buf.WriteTo(w)
+}
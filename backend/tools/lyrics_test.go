@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/bogem/id3v2"
+	"github.com/wanyuqin/tool-collection/logger"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeLyricsText(t *testing.T) {
+	const text = "[00:01.00]故事的小黄花"
+	gbk, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16le := []byte{0xff, 0xfe}
+	for _, r := range text {
+		utf16le = binary.LittleEndian.AppendUint16(utf16le, uint16(r))
+	}
+
+	for name, data := range map[string][]byte{
+		"utf8":    []byte(text),
+		"utf8bom": append([]byte{0xef, 0xbb, 0xbf}, text...),
+		"gbk":     gbk,
+		"utf16":   utf16le,
+	} {
+		got, err := decodeLyricsText(data)
+		if err != nil || got != text {
+			t.Fatalf("%s: expected %q, got %q %v", name, text, got, err)
+		}
+	}
+}
+
+func TestLoadSidecarLyrics(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "晴天.ncm")
+	if lyrics, err := LoadSidecarLyrics(input); lyrics != nil || err != nil {
+		t.Fatalf("expected no lyrics, got %+v %v", lyrics, err)
+	}
+
+	lrc := "[ti:晴天]\n[ar:周杰伦]\n[00:29.5]故事的小黄花\n[00:33.12][01:40.120]从出生那年就飘着\n[00:40.00]\n"
+	tlrc := "[00:29.50]The little yellow flower of the story\n[00:33.12]Has been floating since the year of birth\n"
+	if err := os.WriteFile(filepath.Join(dir, "晴天.lrc"), []byte(lrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "晴天.tlrc"), []byte(tlrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lyrics, err := LoadSidecarLyrics(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLines := []LyricsLine{
+		{29500 * time.Millisecond, "故事的小黄花"},
+		{29500 * time.Millisecond, "The little yellow flower of the story"},
+		{33120 * time.Millisecond, "从出生那年就飘着"},
+		{33120 * time.Millisecond, "Has been floating since the year of birth"},
+		{40 * time.Second, ""},
+		{100120 * time.Millisecond, "从出生那年就飘着"},
+	}
+	if !reflect.DeepEqual(lyrics.Lines, wantLines) {
+		t.Fatalf("unexpected lines %+v", lyrics.Lines)
+	}
+	wantText := "[00:29.50]故事的小黄花\n[00:29.50]The little yellow flower of the story\n" +
+		"[00:33.12]从出生那年就飘着\n[00:33.12]Has been floating since the year of birth\n[00:40.00]\n" +
+		"[01:40.12]从出生那年就飘着"
+	if lyrics.Text != wantText {
+		t.Fatalf("unexpected text %q", lyrics.Text)
+	}
+}
+
+func TestProcessMusicFileLyrics(t *testing.T) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.ncm")
+	writeTestNcm(t, input, testAudio(100), "mp3")
+	writeTestNcm(t, filepath.Join(dir, "b.ncm"), testAudio(100), "mp3")
+	if err := os.WriteFile(filepath.Join(dir, "a.lrc"), []byte("[00:01.00]晴天\n[00:02.50]故事的小黄花"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	results := []TransformResult{
+		ProcessMusicFile(context.Background(), input, DefaultTransformOptions()),
+		ProcessMusicFile(context.Background(), filepath.Join(dir, "b.ncm"), DefaultTransformOptions()),
+	}
+	if !results[0].Lyrics || results[1].Lyrics {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	summary := NewTransformSummary(results, time.Second)
+	if !reflect.DeepEqual(summary.MissingLyrics, []string{results[1].Input}) {
+		t.Fatalf("unexpected missing lyrics %v", summary.MissingLyrics)
+	}
+
+	tag, err := id3v2.Open(results[0].Output, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if got := findLyrics(tag, ""); got != "[00:01.00]晴天\n[00:02.50]故事的小黄花" {
+		t.Fatalf("unexpected USLT %q", got)
+	}
+	frames := tag.GetFrames("SYLT")
+	if len(frames) != 1 {
+		t.Fatalf("expected one SYLT frame, got %d", len(frames))
+	}
+	body := frames[0].(id3v2.UnknownFrame).Body
+	want := append([]byte{3, 'e', 'n', 'g', 2, 1, 0}, "晴天\x00"...)
+	want = append(want, 0, 0, 0x03, 0xe8)
+	want = append(want, "故事的小黄花\x00"...)
+	want = append(want, 0, 0, 0x09, 0xc4)
+	if !reflect.DeepEqual(body, want) {
+		t.Fatalf("unexpected SYLT body %v", body)
+	}
+}
+
+func TestAddMP3TagSyltV3(t *testing.T) {
+	logger.InitLogger()
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetVersion(3)
+	tag.SetTitle("Original")
+	if err = tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	lyrics := &Lyrics{Lines: []LyricsLine{{time.Second, "晴天"}}, Text: "[00:01.00]晴天"}
+	if err = addMP3Tag(path, nil, tagTestMeta, lyrics, DefaultTagOptions()); err != nil {
+		t.Fatal(err)
+	}
+	tag, err = id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Version() != 3 {
+		t.Fatalf("expected v2.3 tag, got v2.%d", tag.Version())
+	}
+	frames := tag.GetFrames("SYLT")
+	if len(frames) != 1 {
+		t.Fatalf("expected one SYLT frame, got %d", len(frames))
+	}
+	body := frames[0].(id3v2.UnknownFrame).Body
+	want := []byte{1, 'e', 'n', 'g', 2, 1, 0, 0, 0xff, 0xfe, 0x74, 0x66, 0x29, 0x59, 0, 0, 0, 0, 0x03, 0xe8}
+	if !reflect.DeepEqual(body, want) {
+		t.Fatalf("unexpected SYLT body %v", body)
+	}
+}
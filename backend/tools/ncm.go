@@ -2,338 +2,336 @@ package tools
 
 import (
 	"bytes"
-	"context"
 	"crypto/aes"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
-	"github.com/bogem/id3v2"
-	"github.com/go-flac/flacpicture"
-	"github.com/go-flac/flacvorbis"
-	"github.com/go-flac/go-flac"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"os"
-	"strings"
-	"time"
 )
 
-func ProcessNcmFile(ctx context.Context, name string) {
-	fp, err := os.Open(name)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer fp.Close()
+var (
+	NotNcmFileErr   = errors.New("isn't netease cloud music copyright file")
+	NcmBadKeyErr    = errors.New("ncm key block is invalid")
+	NcmBadMetaErr   = errors.New("ncm meta data is invalid")
+	NcmTruncatedErr = errors.New("ncm audio data is truncated")
+	NcmCrcErr       = errors.New("ncm header crc32 mismatch")
+)
 
-	var rBuf = make([]byte, 4)
-	uLen := readUint32(rBuf, fp)
+// NcmError NCM解析错误 Kind 为上面定义的错误类型之一, Err 为底层错误
+type NcmError struct {
+	Kind error
+	Err  error
+}
 
-	if uLen != 0x4e455443 {
-		log.Println("isn't netease cloud music copyright file!")
-		return
+func (e *NcmError) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
 	}
+	return fmt.Sprintf("%s: %v", e.Kind.Error(), e.Err)
+}
 
-	uLen = readUint32(rBuf, fp)
-	if uLen != 0x4d414446 {
-		log.Println("isn't netease cloud music copyright file!")
-		return
-	}
+func (e *NcmError) Is(target error) bool {
+	return e.Kind == target
+}
 
-	fp.Seek(2, 1)
-	uLen = readUint32(rBuf, fp)
+func (e *NcmError) Unwrap() error {
+	return e.Err
+}
 
-	var keyData = make([]byte, uLen)
-	_, err = fp.Read(keyData)
-	checkError(err)
+func newNcmError(kind, err error) error {
+	return &NcmError{Kind: kind, Err: err}
+}
 
-	for i := range keyData {
-		keyData[i] ^= 0x64
-	}
+const (
+	ncmMagicHeader1 = 0x4e455443
+	ncmMagicHeader2 = 0x4d414446
+	// len("neteasecloudmusic")
+	ncmKeyPrefixLen = 17
+	// len("163 key(Don't modify):")
+	ncmMetaPrefixLen = 22
+)
 
-	deKeyData, err := decryptAes128Ecb(aesCoreKey, fixBlockSize(keyData))
-	checkError(err)
+// NcmReader NCM解码器 解析文件头部的密钥、元数据和封面, Read 返回解密后的音频数据
+type NcmReader struct {
+	r     io.ReadSeeker
+	meta  MetaInfo
+	cover []byte
+	audio *cipherReader
 
-	// 17 = len("neteasecloudmusic")
-	deKeyData = deKeyData[17:]
+	// 文件中记录的crc32以及根据密钥和元数据计算出的crc32
+	crcStored   uint32
+	crcComputed uint32
 
-	uLen = readUint32(rBuf, fp)
-	var modifyData = make([]byte, uLen)
-	_, err = fp.Read(modifyData)
-	checkError(err)
+	// 音频数据大小
+	audioSize int64
+}
 
-	for i := range modifyData {
-		modifyData[i] ^= 0x63
+// NewNcmReader 解析NCM头部 返回的 NcmReader 定位在音频数据的起始位置
+func NewNcmReader(r io.ReadSeeker) (*NcmReader, error) {
+	nr := &NcmReader{r: r}
+
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, newNcmError(NotNcmFileErr, err)
+	}
+	if binary.LittleEndian.Uint32(header[:4]) != ncmMagicHeader1 ||
+		binary.LittleEndian.Uint32(header[4:]) != ncmMagicHeader2 {
+		return nil, newNcmError(NotNcmFileErr, nil)
 	}
-	deModifyData := make([]byte, base64.StdEncoding.DecodedLen(len(modifyData)-22))
-	_, err = base64.StdEncoding.Decode(deModifyData, modifyData[22:])
-	checkError(err)
 
-	deData, err := decryptAes128Ecb(aesModifyKey, fixBlockSize(deModifyData))
-	checkError(err)
+	// 跳过2字节的版本信息
+	if _, err := io.CopyN(io.Discard, r, 2); err != nil {
+		return nil, newNcmError(NcmBadKeyErr, err)
+	}
 
-	// 6 = len("music:")
-	deData = deData[6:]
+	// 长度字段来自文件 分配内存前和剩余大小比较 截断或构造的文件不会申请几GB的内存
+	size, err := seekSize(r)
+	if err != nil {
+		return nil, err
+	}
+	remaining := func() int64 {
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0
+		}
+		return size - pos
+	}
 
-	var meta MetaInfo
-	err = json.Unmarshal(deData, &meta)
-	checkError(err)
+	// crc32 覆盖密钥块和元数据块(包含长度字段)的原始字节
+	hash := crc32.NewIEEE()
+	tr := io.TeeReader(r, hash)
 
-	// crc32 check
-	fp.Seek(4, 1)
-	fp.Seek(5, 1)
+	key, err := readNcmKey(tr, remaining())
+	if err != nil {
+		return nil, err
+	}
+	nr.audio = newCipherReader(r, newNcmCipher(key))
 
-	imgLen := readUint32(rBuf, fp)
+	nr.meta, err = readNcmMeta(tr, remaining())
+	if err != nil {
+		return nil, err
+	}
+	nr.crcComputed = hash.Sum32()
+
+	nr.crcStored, err = readUint32(r)
+	if err != nil {
+		return nil, newNcmError(NcmTruncatedErr, err)
+	}
+	// 5字节的间隙
+	if _, err = io.CopyN(io.Discard, r, 5); err != nil {
+		return nil, newNcmError(NcmTruncatedErr, err)
+	}
 
-	imgData := func() []byte {
-		if imgLen > 0 {
-			data := make([]byte, imgLen)
-			_, err = fp.Read(data)
-			checkError(err)
-			return data
+	imgLen, err := readUint32(r)
+	if err != nil {
+		return nil, newNcmError(NcmTruncatedErr, err)
+	}
+	if int64(imgLen) > remaining() {
+		return nil, newNcmError(NcmTruncatedErr, lengthExceedsErr("cover", imgLen, remaining()))
+	}
+	if imgLen > 0 {
+		nr.cover = make([]byte, imgLen)
+		if _, err = io.ReadFull(r, nr.cover); err != nil {
+			return nil, newNcmError(NcmTruncatedErr, err)
 		}
-		return nil
-	}()
+	}
 
-	box := buildKeyBox(deKeyData)
-	n := 0x8000
+	// 计算音频数据大小
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := seekSize(r)
+	if err != nil {
+		return nil, err
+	}
+	nr.audioSize = end - start
+	if nr.audioSize <= 0 {
+		return nil, newNcmError(NcmTruncatedErr, nil)
+	}
 
-	outputName := strings.Replace(name, ".ncm", "."+meta.Format, -1)
+	return nr, nil
+}
 
-	fpOut, err := os.OpenFile(outputName, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
-	checkError(err)
+// Meta 元数据
+func (n *NcmReader) Meta() *MetaInfo {
+	return &n.meta
+}
 
-	var tb = make([]byte, n)
-	for {
-		_, err := fp.Read(tb)
-		if err == io.EOF { // read EOF
-			break
-		} else if err != nil {
-			log.Println(err)
-		}
-		for i := 0; i < n; i++ {
-			j := byte((i + 1) & 0xff)
-			tb[i] ^= box[(box[j]+box[(box[j]+j)&0xff])&0xff]
-		}
-		_, err = fpOut.Write(tb)
-		if err != nil {
-			log.Println(err)
-		}
-	}
-	fpOut.Close()
+// Cover 内嵌的封面图片 没有时返回nil
+func (n *NcmReader) Cover() []byte {
+	return n.cover
+}
 
-	log.Println(outputName)
-	switch meta.Format {
-	case "mp3":
-		addMP3Tag(outputName, imgData, &meta)
-	case "flac":
-		addFLACTag(outputName, imgData, &meta)
+// CheckCrc 校验文件中记录的crc32 不一致时返回 NcmCrcErr
+func (n *NcmReader) CheckCrc() error {
+	if n.crcStored != n.crcComputed {
+		return newNcmError(NcmCrcErr, fmt.Errorf("stored %08x, computed %08x", n.crcStored, n.crcComputed))
 	}
+	return nil
+}
 
+// AudioSize 音频数据大小
+func (n *NcmReader) AudioSize() int64 {
+	return n.audioSize
 }
 
-func addMP3Tag(fileName string, imgData []byte, meta *MetaInfo) {
-	tag, err := id3v2.Open(fileName, id3v2.Options{Parse: true})
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer tag.Close()
+// Format 元数据中记录的音频格式
+func (n *NcmReader) Format() string {
+	return n.meta.Format
+}
 
-	if imgData == nil && meta.AlbumPic != "" {
-		imgData = fetchUrl(meta.AlbumPic)
+// Read 读取并解密音频数据
+func (n *NcmReader) Read(p []byte) (int, error) {
+	c, err := n.audio.Read(p)
+	if err == io.EOF && n.audio.offset < n.audioSize {
+		return c, newNcmError(NcmTruncatedErr, io.ErrUnexpectedEOF)
 	}
+	return c, err
+}
 
-	if imgData != nil {
-		picMIME := "image/jpeg"
-		if containPNGHeader(imgData) {
-			picMIME = "image/png"
-		}
-		pic := id3v2.PictureFrame{
-			Encoding:    id3v2.EncodingISO,
-			MimeType:    picMIME,
-			PictureType: id3v2.PTFrontCover,
-			Description: "Front cover",
-			Picture:     imgData,
-		}
-		tag.AddAttachedPicture(pic)
-	} else if meta.AlbumPic != "" {
-		pic := id3v2.PictureFrame{
-			Encoding:    id3v2.EncodingISO,
-			MimeType:    "-->",
-			PictureType: id3v2.PTFrontCover,
-			Description: "Front cover",
-			Picture:     []byte(meta.AlbumPic),
-		}
-		tag.AddAttachedPicture(pic)
-	}
+// ncmCipher NCM音频数据的密钥流
+// 密钥流只和偏移量 mod 256 有关 预先计算256字节
+type ncmCipher struct {
+	// stream[i] 为偏移量 i%256 处的密钥 重复两遍便于按连续区间异或
+	stream [512]byte
+}
 
-	if tag.GetTextFrame("TIT2").Text == "" {
-		if meta.MusicName != "" {
-			log.Println("Adding music name")
-			tag.AddTextFrame("TIT2", id3v2.EncodingUTF8, meta.MusicName)
-		}
+func newNcmCipher(key []byte) *ncmCipher {
+	box := buildKeyBox(key)
+	c := &ncmCipher{}
+	for i := 0; i < 256; i++ {
+		j := byte(i + 1)
+		c.stream[i] = box[(box[j]+box[(box[j]+j)&0xff])&0xff]
 	}
+	copy(c.stream[256:], c.stream[:256])
+	return c
+}
 
-	if tag.GetTextFrame("TALB").Text == "" {
-		if meta.Album != "" {
-			log.Println("Adding album name")
-			tag.AddTextFrame("TALB", id3v2.EncodingUTF8, meta.Album)
-		}
-	}
+func (c *ncmCipher) Decrypt(buf []byte, offset int64) {
+	parallelDecrypt(buf, offset, c.decrypt)
+}
 
-	if tag.GetTextFrame("TPE1").Text == "" {
-		artist := func() []string {
-			res := make([]string, 0)
-			if len(meta.Artist) < 1 {
-				return nil
-			}
-			for _, artist := range meta.Artist {
-				res = append(res, artist[0].(string))
-			}
-			return res
-		}()
-		if artist != nil {
-			log.Println("Adding artist")
-			for _, name := range artist {
-				tag.AddTextFrame("TPE1", id3v2.EncodingUTF8, name)
-			}
-		}
+func (c *ncmCipher) decrypt(buf []byte, offset int64) {
+	for len(buf) > 0 {
+		start := offset & 0xff
+		n := subtle.XORBytes(buf, buf, c.stream[start:start+256])
+		buf = buf[n:]
+		offset += int64(n)
 	}
+}
 
-	if err = tag.Save(); err != nil {
-		log.Println(err)
-	}
+// ncmDecryptor 网易云音乐 .ncm
+type ncmDecryptor struct {
+}
+
+func NewNcmDecryptor() Decryptor {
+	return &ncmDecryptor{}
+}
+
+func (d *ncmDecryptor) Name() string {
+	return "ncm"
+}
+
+func (d *ncmDecryptor) Extensions() []string {
+	return []string{".ncm"}
+}
+
+func (d *ncmDecryptor) Match(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("CTENFDAM"))
+}
+
+func (d *ncmDecryptor) Open(r io.ReadSeeker, name string) (DecryptedAudio, error) {
+	return NewNcmReader(r)
+}
+
+// lengthExceedsErr 长度字段超过文件剩余大小 按文件提前结束处理
+func lengthExceedsErr(name string, length uint32, remaining int64) error {
+	return fmt.Errorf("%s length %d exceeds remaining %d bytes: %w", name, length, remaining, io.ErrUnexpectedEOF)
 }
 
-func addFLACTag(fileName string, imgData []byte, meta *MetaInfo) {
-	f, err := flac.ParseFile(fileName)
+// readNcmKey remaining 为长度字段开始的剩余字节数
+func readNcmKey(r io.Reader, remaining int64) ([]byte, error) {
+	keyLen, err := readUint32(r)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, newNcmError(NcmBadKeyErr, err)
 	}
-
-	if imgData == nil && meta.AlbumPic != "" {
-		imgData = fetchUrl(meta.AlbumPic)
+	if keyLen == 0 || keyLen%aes.BlockSize != 0 {
+		return nil, newNcmError(NcmBadKeyErr, fmt.Errorf("bad key length %d", keyLen))
 	}
-
-	if imgData != nil {
-		picMIME := "image/jpeg"
-		if containPNGHeader(imgData) {
-			picMIME = "image/png"
-		}
-		picture, err := flacpicture.NewFromImageData(flacpicture.PictureTypeFrontCover, "Front cover", imgData, picMIME)
-		if err == nil {
-			picturemeta := picture.Marshal()
-			f.Meta = append(f.Meta, &picturemeta)
-		}
-	} else if meta.AlbumPic != "" {
-		picture := &flacpicture.MetadataBlockPicture{
-			PictureType: flacpicture.PictureTypeFrontCover,
-			MIME:        "-->",
-			Description: "Front cover",
-			ImageData:   []byte(meta.AlbumPic),
-		}
-		picturemeta := picture.Marshal()
-		f.Meta = append(f.Meta, &picturemeta)
+	if int64(keyLen) > remaining-4 {
+		return nil, newNcmError(NcmBadKeyErr, lengthExceedsErr("key", keyLen, remaining-4))
 	}
 
-	var cmtmeta *flac.MetaDataBlock
-	for _, m := range f.Meta {
-		if m.Type == flac.VorbisComment {
-			cmtmeta = m
-			break
-		}
+	keyData := make([]byte, keyLen)
+	if _, err = io.ReadFull(r, keyData); err != nil {
+		return nil, newNcmError(NcmBadKeyErr, err)
 	}
-	var cmts *flacvorbis.MetaDataBlockVorbisComment
-	if cmtmeta != nil {
-		cmts, err = flacvorbis.ParseFromMetaDataBlock(*cmtmeta)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-	} else {
-		cmts = flacvorbis.New()
+	for i := range keyData {
+		keyData[i] ^= 0x64
 	}
 
-	if titles, err := cmts.Get(flacvorbis.FIELD_TITLE); err != nil {
-		log.Println(err)
-		return
-	} else if len(titles) == 0 {
-		if meta.MusicName != "" {
-			log.Println("Adding music name")
-			cmts.Add(flacvorbis.FIELD_TITLE, meta.MusicName)
-		}
+	deKeyData, err := decryptAes128Ecb(aesCoreKey, fixBlockSize(keyData))
+	if err != nil {
+		return nil, newNcmError(NcmBadKeyErr, err)
 	}
-
-	if albums, err := cmts.Get(flacvorbis.FIELD_ALBUM); err != nil {
-		log.Println(err)
-		return
-	} else if len(albums) == 0 {
-		if meta.Album != "" {
-			log.Println("Adding album name")
-			cmts.Add(flacvorbis.FIELD_ALBUM, meta.Album)
-		}
+	if len(deKeyData) <= ncmKeyPrefixLen || string(deKeyData[:ncmKeyPrefixLen]) != "neteasecloudmusic" {
+		return nil, newNcmError(NcmBadKeyErr, nil)
 	}
+	return deKeyData[ncmKeyPrefixLen:], nil
+}
 
-	if artists, err := cmts.Get(flacvorbis.FIELD_ARTIST); err != nil {
-		log.Println(err)
-		return
-	} else if len(artists) == 0 {
-		artist := func() []string {
-			res := make([]string, 0)
-			if len(meta.Artist) < 1 {
-				return nil
-			}
-			for _, artist := range meta.Artist {
-				res = append(res, artist[0].(string))
-			}
-			return res
-		}()
-		if artist != nil {
-			log.Println("Adding artist")
-			for _, name := range artist {
-				cmts.Add(flacvorbis.FIELD_ARTIST, name)
-			}
-		}
+// readNcmMeta remaining 为长度字段开始的剩余字节数
+func readNcmMeta(r io.Reader, remaining int64) (MetaInfo, error) {
+	var meta MetaInfo
+
+	metaLen, err := readUint32(r)
+	if err != nil {
+		return meta, newNcmError(NcmBadMetaErr, err)
+	}
+	// 部分文件没有元数据
+	if metaLen == 0 {
+		return meta, nil
 	}
-	res := cmts.Marshal()
-	if cmtmeta != nil {
-		*cmtmeta = res
-	} else {
-		f.Meta = append(f.Meta, &res)
+	if metaLen <= ncmMetaPrefixLen {
+		return meta, newNcmError(NcmBadMetaErr, fmt.Errorf("bad meta length %d", metaLen))
+	}
+	if int64(metaLen) > remaining-4 {
+		return meta, newNcmError(NcmBadMetaErr, lengthExceedsErr("meta", metaLen, remaining-4))
 	}
 
-	f.Save(fileName)
-}
+	modifyData := make([]byte, metaLen)
+	if _, err = io.ReadFull(r, modifyData); err != nil {
+		return meta, newNcmError(NcmBadMetaErr, err)
+	}
+	for i := range modifyData {
+		modifyData[i] ^= 0x63
+	}
 
-func fetchUrl(url string) []byte {
-	req, err := http.NewRequest("GET", url, bytes.NewBuffer([]byte{}))
+	deModifyData := make([]byte, base64.StdEncoding.DecodedLen(len(modifyData)-ncmMetaPrefixLen))
+	dn, err := base64.StdEncoding.Decode(deModifyData, modifyData[ncmMetaPrefixLen:])
 	if err != nil {
-		log.Println(err)
-		return nil
+		return meta, newNcmError(NcmBadMetaErr, err)
 	}
-	client := http.Client{
-		Timeout: 30 * time.Second,
-	}
-	res, err := client.Do(req)
+
+	deData, err := decryptAes128Ecb(aesModifyKey, fixBlockSize(deModifyData[:dn]))
 	if err != nil {
-		log.Println(err)
-		return nil
+		return meta, newNcmError(NcmBadMetaErr, err)
 	}
-	if res.StatusCode != http.StatusOK {
-		log.Printf("Failed to download album pic: remote returned %d\n", res.StatusCode)
-		return nil
+	// 普通歌曲以 "music:" 开头 电台节目以 "dj:" 开头
+	prefix, body, ok := bytes.Cut(deData, []byte(":"))
+	if !ok || (string(prefix) != "music" && string(prefix) != "dj") {
+		return meta, newNcmError(NcmBadMetaErr, fmt.Errorf("unknown meta prefix %q", prefix))
 	}
-	defer res.Body.Close()
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Println(err)
-		return nil
+
+	if err = json.Unmarshal(body, &meta); err != nil {
+		return meta, newNcmError(NcmBadMetaErr, err)
 	}
-	return data
+	return meta, nil
 }
 
 var (
@@ -341,23 +339,6 @@ var (
 	aesModifyKey = []byte{0x23, 0x31, 0x34, 0x6C, 0x6A, 0x6B, 0x5F, 0x21, 0x5C, 0x5D, 0x26, 0x30, 0x55, 0x3C, 0x27, 0x28}
 )
 
-type MetaInfo struct {
-	MusicID       int             `json:"musicId"`
-	MusicName     string          `json:"musicName"`
-	Artist        [][]interface{} `json:"artist"` // [[string,int],]
-	AlbumID       int             `json:"albumId"`
-	Album         string          `json:"album"`
-	AlbumPicDocID interface{}     `json:"albumPicDocId"` // string or int
-	AlbumPic      string          `json:"albumPic"`
-	BitRate       int             `json:"bitrate"`
-	Mp3DocID      string          `json:"mp3DocId"`
-	Duration      int             `json:"duration"`
-	MvID          int             `json:"mvId"`
-	Alias         []string        `json:"alias"`
-	TransNames    []interface{}   `json:"transNames"`
-	Format        string          `json:"format"`
-}
-
 func buildKeyBox(key []byte) []byte {
 	box := make([]byte, 256)
 	for i := 0; i < 256; i++ {
@@ -381,17 +362,16 @@ func fixBlockSize(src []byte) []byte {
 	return src[:len(src)/aes.BlockSize*aes.BlockSize]
 }
 
-func containPNGHeader(data []byte) bool {
-	if len(data) < 8 {
-		return false
-	}
-	return string(data[:8]) == string([]byte{137, 80, 78, 71, 13, 10, 26, 10})
-}
-
-func PKCS7UnPadding(src []byte) []byte {
+func PKCS7UnPadding(src []byte) ([]byte, error) {
 	length := len(src)
+	if length == 0 {
+		return nil, errors.New("pkcs7: data is empty")
+	}
 	unpadding := int(src[length-1])
-	return src[:(length - unpadding)]
+	if unpadding == 0 || unpadding > length {
+		return nil, errors.New("pkcs7: invalid padding")
+	}
+	return src[:(length - unpadding)], nil
 }
 
 func decryptAes128Ecb(key, data []byte) ([]byte, error) {
@@ -405,17 +385,13 @@ func decryptAes128Ecb(key, data []byte) ([]byte, error) {
 	for i := 0; i <= dataLen-bs; i += bs {
 		block.Decrypt(decrypted[i:i+bs], data[i:i+bs])
 	}
-	return PKCS7UnPadding(decrypted), nil
-}
-
-func readUint32(rBuf []byte, fp *os.File) uint32 {
-	_, err := fp.Read(rBuf)
-	checkError(err)
-	return binary.LittleEndian.Uint32(rBuf)
+	return PKCS7UnPadding(decrypted)
 }
 
-func checkError(err error) {
-	if err != nil {
-		log.Panic(err)
+func readUint32(r io.Reader) (uint32, error) {
+	var rBuf [4]byte
+	if _, err := io.ReadFull(r, rBuf[:]); err != nil {
+		return 0, err
 	}
+	return binary.LittleEndian.Uint32(rBuf[:]), nil
 }
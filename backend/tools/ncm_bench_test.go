@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/backend/pool"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+var benchKey = []byte("0123456789abcdef0123456789abcdef")
+
+// ncmReferenceDecrypt 逐字节计算密钥流 作为对照
+func ncmReferenceDecrypt(box []byte, buf []byte, offset int64) {
+	for i := range buf {
+		j := byte((offset + int64(i) + 1) & 0xff)
+		buf[i] ^= box[(box[j]+box[(box[j]+j)&0xff])&0xff]
+	}
+}
+
+func TestNcmCipher_Decrypt(t *testing.T) {
+	threshold := parallelDecryptThreshold
+	parallelDecryptThreshold = 1024
+	defer func() {
+		parallelDecryptThreshold = threshold
+	}()
+
+	box := buildKeyBox(benchKey)
+	cipher := newNcmCipher(benchKey)
+	for _, size := range []int{1, 255, 256, 257, 1023, 1024, 4097, 100003} {
+		for _, offset := range []int64{0, 1, 255, 256, 0x8000 + 7} {
+			want := testAudio(size)
+			got := append([]byte{}, want...)
+			ncmReferenceDecrypt(box, want, offset)
+			cipher.Decrypt(got, offset)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("size %d offset %d: keystream mismatch", size, offset)
+			}
+		}
+	}
+}
+
+func BenchmarkNcmCipher(b *testing.B) {
+	buf := testAudio(1 << 20)
+	box := buildKeyBox(benchKey)
+	cipher := newNcmCipher(benchKey)
+
+	b.Run("reference", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		for i := 0; i < b.N; i++ {
+			ncmReferenceDecrypt(box, buf, 0)
+		}
+	})
+	b.Run("keystream", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		for i := 0; i < b.N; i++ {
+			cipher.decrypt(buf, 0)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		for i := 0; i < b.N; i++ {
+			cipher.Decrypt(buf, 0)
+		}
+	})
+}
+
+// BenchmarkNcmReader 单个文件的解密吞吐量
+func BenchmarkNcmReader(b *testing.B) {
+	audio := testAudio(32 << 20)
+	data := encodeTestNcm(b, audio, &MetaInfo{Format: "flac"}, nil)
+	buf := make([]byte, transformBufferSize)
+
+	b.SetBytes(int64(len(audio)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := NewNcmReader(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = io.CopyBuffer(io.Discard, struct{ io.Reader }{reader}, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTransformBatch 批量转换的吞吐量 包括文件读写
+func BenchmarkTransformBatch(b *testing.B) {
+	logger.InitLogger()
+	const files, size = 16, 4 << 20
+
+	dir := b.TempDir()
+	inputs := make([]string, files)
+	for i := range inputs {
+		inputs[i] = filepath.Join(dir, fmt.Sprintf("%02d.ncm", i))
+		// 没有可识别的格式时不会写入标签
+		data := encodeTestNcm(b, testAudio(size), &MetaInfo{Format: "ogg"}, nil)
+		if err := os.WriteFile(inputs[i], data, 0666); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	options := DefaultTransformOptions()
+	options.OutputDir = filepath.Join(dir, "out")
+	options.ConflictPolicy = configs.ConflictOverwrite
+
+	b.SetBytes(files * size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := pool.New[TransformResult](context.Background(), runtime.NumCPU())
+		for _, input := range inputs {
+			input := input
+			p.Submit(func(ctx context.Context) (TransformResult, error) {
+				result := ProcessMusicFile(ctx, input, options)
+				return result, result.Err
+			})
+		}
+		p.Wait()
+		if err := p.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// coverThumbnailSize 封面缩略图的最大边长
+const coverThumbnailSize = 96
+
+// NcmInfo NCM文件的歌曲信息 只解析文件头 不解密音频数据
+type NcmInfo struct {
+	Title   string   `json:"title"`
+	Artists []string `json:"artists"`
+	Album   string   `json:"album"`
+	Format  string   `json:"format"`
+	BitRate int      `json:"bitrate"`
+	// 时长 毫秒
+	Duration int `json:"duration"`
+	// 封面缩略图 data URL 没有封面时为空
+	Cover string `json:"cover"`
+}
+
+// InspectNcm 读取NCM文件的密钥、元数据和内嵌封面
+func InspectNcm(path string) (*NcmInfo, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	reader, err := NewNcmReader(fp)
+	if err != nil {
+		return nil, err
+	}
+	return NewNcmInfo(reader), nil
+}
+
+// NewNcmInfo 根据已解析的文件头生成歌曲信息
+func NewNcmInfo(reader *NcmReader) *NcmInfo {
+	meta := reader.Meta()
+	return &NcmInfo{
+		Title:    meta.MusicName,
+		Artists:  meta.ArtistNames(),
+		Album:    meta.Album,
+		Format:   meta.Format,
+		BitRate:  meta.BitRate,
+		Duration: meta.Duration,
+		Cover:    coverThumbnail(reader.Cover(), coverThumbnailSize),
+	}
+}
+
+// coverThumbnail 将封面缩放到 size 以内并编码为 jpeg data URL 无法识别的图片返回空字符串
+func coverThumbnail(data []byte, size int) string {
+	if !isImage(data) {
+		return ""
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= 0 || h <= 0 {
+		return ""
+	}
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, h*size/w
+		} else {
+			w, h = w*size/h, size
+		}
+		if w == 0 {
+			w = 1
+		}
+		if h == 0 {
+			h = 1
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/h
+		for x := 0; x < w; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/w
+			thumb.Set(x, y, img.At(sx, sy))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err = jpeg.Encode(buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return ""
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
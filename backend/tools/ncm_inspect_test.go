@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspectNcm(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 150))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(0, 0, color.Black)
+	cover := &bytes.Buffer{}
+	if err := png.Encode(cover, img); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := &MetaInfo{
+		MusicName: "晴天",
+		Artist:    []NcmArtist{{Name: "周杰伦", ID: 6452}},
+		Album:     "叶惠美",
+		BitRate:   320000,
+		Duration:  269000,
+		Format:    "flac",
+	}
+	path := filepath.Join(t.TempDir(), "a.ncm")
+	if err := os.WriteFile(path, encodeTestNcm(t, testAudio(1024), meta, cover.Bytes()), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := InspectNcm(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "晴天" || info.Album != "叶惠美" || info.Format != "flac" ||
+		info.BitRate != 320000 || info.Duration != 269000 || !reflect.DeepEqual(info.Artists, []string{"周杰伦"}) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	const prefix = "data:image/jpeg;base64,"
+	if !strings.HasPrefix(info.Cover, prefix) {
+		t.Fatalf("unexpected cover %.40q", info.Cover)
+	}
+	data, err := base64.StdEncoding.DecodeString(info.Cover[len(prefix):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := thumb.Bounds().Size(); size.X != coverThumbnailSize || size.Y != coverThumbnailSize/2 {
+		t.Fatalf("unexpected thumbnail size %v", size)
+	}
+}
+
+func TestInspectNcm_NoCover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.ncm")
+	if err := os.WriteFile(path, encodeTestNcm(t, testAudio(16), nil, []byte("not an image")), 0666); err != nil {
+		t.Fatal(err)
+	}
+	info, err := InspectNcm(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Cover != "" || info.Title != "" || len(info.Artists) != 0 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+}
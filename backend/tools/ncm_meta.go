@@ -0,0 +1,211 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// MetaInfo NCM元数据 兼容普通歌曲(music)和电台节目(dj)两种格式
+type MetaInfo struct {
+	MusicID       int         `json:"musicId"`
+	MusicName     string      `json:"musicName"`
+	Artist        []NcmArtist `json:"artist"`
+	AlbumID       int         `json:"albumId"`
+	Album         string      `json:"album"`
+	AlbumPicDocID NcmDocID    `json:"albumPicDocId"`
+	AlbumPic      string      `json:"albumPic"`
+	BitRate       int         `json:"bitrate"`
+	Mp3DocID      NcmDocID    `json:"mp3DocId"`
+	Duration      int         `json:"duration"`
+	MvID          int         `json:"mvId"`
+	Alias         []string    `json:"alias"`
+	TransNames    []string    `json:"transNames"`
+	Format        string      `json:"format"`
+	// 电台节目信息 普通歌曲为空
+	Dj *NcmDjInfo `json:"dj,omitempty"`
+}
+
+// NcmArtist 歌手 NCM中为 ["name", id] 也兼容 {"name": "", "id": 0}
+type NcmArtist struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+// NcmDocID 图片或音频的文档ID NCM中可能是字符串也可能是数字
+type NcmDocID string
+
+// NcmDjInfo 电台节目信息
+type NcmDjInfo struct {
+	ProgramID   int    `json:"programId"`
+	ProgramName string `json:"programName"`
+	DjName      string `json:"djName"`
+	RadioName   string `json:"radioName"`
+}
+
+// ArtistNames 歌手名称 忽略空名称
+func (m *MetaInfo) ArtistNames() []string {
+	names := make([]string, 0, len(m.Artist))
+	for _, artist := range m.Artist {
+		if artist.Name != "" {
+			names = append(names, artist.Name)
+		}
+	}
+	return names
+}
+
+// UnmarshalJSON 字段类型不符合预期时忽略该字段 不返回错误
+// 电台节目的歌曲信息在 mainMusic 中
+func (m *MetaInfo) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = MetaInfo{}
+
+	if mainMusic, ok := raw["mainMusic"]; ok || raw["programName"] != nil {
+		if ok {
+			var main MetaInfo
+			if err := json.Unmarshal(mainMusic, &main); err == nil {
+				*m = main
+			}
+		}
+		dj := &NcmDjInfo{
+			ProgramID:   jsonInt(raw["programId"]),
+			ProgramName: jsonString(raw["programName"]),
+			DjName:      jsonString(raw["djName"]),
+			RadioName:   jsonString(raw["radioName"]),
+		}
+		// 部分节目 mainMusic 中没有歌曲信息
+		if m.MusicName == "" {
+			m.MusicName = dj.ProgramName
+		}
+		if len(m.Artist) == 0 && dj.DjName != "" {
+			m.Artist = []NcmArtist{{Name: dj.DjName}}
+		}
+		if m.Album == "" {
+			m.Album = dj.RadioName
+		}
+		if m.Format == "" {
+			m.Format = jsonString(raw["format"])
+		}
+		m.Dj = dj
+		return nil
+	}
+
+	m.MusicID = jsonInt(raw["musicId"])
+	m.MusicName = jsonString(raw["musicName"])
+	m.AlbumID = jsonInt(raw["albumId"])
+	m.Album = jsonString(raw["album"])
+	m.AlbumPicDocID = NcmDocID(jsonString(raw["albumPicDocId"]))
+	m.AlbumPic = jsonString(raw["albumPic"])
+	m.BitRate = jsonInt(raw["bitrate"])
+	m.Mp3DocID = NcmDocID(jsonString(raw["mp3DocId"]))
+	m.Duration = jsonInt(raw["duration"])
+	m.MvID = jsonInt(raw["mvId"])
+	m.Alias = jsonStrings(raw["alias"])
+	m.TransNames = jsonStrings(raw["transNames"])
+	m.Format = jsonString(raw["format"])
+	if dj, ok := raw["dj"]; ok {
+		m.Dj = &NcmDjInfo{}
+		if json.Unmarshal(dj, m.Dj) != nil {
+			m.Dj = nil
+		}
+	}
+
+	var artists []json.RawMessage
+	if json.Unmarshal(raw["artist"], &artists) == nil {
+		for _, item := range artists {
+			var artist NcmArtist
+			if artist.UnmarshalJSON(item) == nil && artist.Name != "" {
+				m.Artist = append(m.Artist, artist)
+			}
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON 兼容 ["name", id] {"name": "", "id": 0} 和 "name"
+func (a *NcmArtist) UnmarshalJSON(data []byte) error {
+	*a = NcmArtist{}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	switch data[0] {
+	case '[':
+		var fields []json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			a.Name = jsonString(fields[0])
+		}
+		if len(fields) > 1 {
+			a.ID = jsonInt(fields[1])
+		}
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		a.Name = jsonString(fields["name"])
+		a.ID = jsonInt(fields["id"])
+	default:
+		a.Name = jsonString(data)
+	}
+	return nil
+}
+
+// UnmarshalJSON 兼容字符串和数字
+func (d *NcmDocID) UnmarshalJSON(data []byte) error {
+	*d = NcmDocID(jsonString(data))
+	return nil
+}
+
+// jsonString 字符串或数字 其他类型返回空字符串
+func jsonString(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if raw[0] == '"' {
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+		return ""
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// jsonInt 数字或数字字符串 其他类型返回0
+func jsonInt(raw json.RawMessage) int {
+	s := jsonString(raw)
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return int(f)
+	}
+	return 0
+}
+
+// jsonStrings 字符串数组 忽略非字符串的元素
+func jsonStrings(raw json.RawMessage) []string {
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) != nil || items == nil {
+		return nil
+	}
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		if s := jsonString(item); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
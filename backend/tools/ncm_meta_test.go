@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMetaInfo_UnmarshalMusic(t *testing.T) {
+	data := `{"musicId":186001,"musicName":"晴天","artist":[["周杰伦",6452],["杨瑞代","12"]],
+		"albumId":18905,"album":"叶惠美","albumPicDocId":109951163076136682,
+		"albumPic":"https://p3.music.126.net/a.jpg","bitrate":320000,"mp3DocId":"5f3c",
+		"duration":269000,"mvId":0,"alias":[],"transNames":["晴朗的日子"],"format":"mp3"}`
+
+	var meta MetaInfo
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		t.Fatal(err)
+	}
+	want := MetaInfo{
+		MusicID:       186001,
+		MusicName:     "晴天",
+		Artist:        []NcmArtist{{Name: "周杰伦", ID: 6452}, {Name: "杨瑞代", ID: 12}},
+		AlbumID:       18905,
+		Album:         "叶惠美",
+		AlbumPicDocID: "109951163076136682",
+		AlbumPic:      "https://p3.music.126.net/a.jpg",
+		BitRate:       320000,
+		Mp3DocID:      "5f3c",
+		Duration:      269000,
+		Alias:         []string{},
+		TransNames:    []string{"晴朗的日子"},
+		Format:        "mp3",
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("meta mismatch\nwant %+v\ngot  %+v", want, meta)
+	}
+}
+
+func TestMetaInfo_UnmarshalUnexpectedShape(t *testing.T) {
+	// 字段类型与预期不符时不能panic 也不能返回错误
+	data := `{"musicId":"186001","musicName":123,"artist":[[6452,"周杰伦"],[],null,"陈奕迅",{"name":"林俊杰","id":3684},[true]],
+		"albumPicDocId":null,"alias":"not an array","transNames":[1,null,"晴朗的日子"],"duration":"269000.0","mvId":{}}`
+
+	var meta MetaInfo
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.MusicID != 186001 || meta.MusicName != "123" || meta.Duration != 269000 || meta.MvID != 0 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	wantArtists := []string{"6452", "陈奕迅", "林俊杰"}
+	if !reflect.DeepEqual(meta.ArtistNames(), wantArtists) {
+		t.Fatalf("expected artists %v, got %v", wantArtists, meta.ArtistNames())
+	}
+	if meta.Alias != nil || !reflect.DeepEqual(meta.TransNames, []string{"1", "晴朗的日子"}) {
+		t.Fatalf("unexpected names %v %v", meta.Alias, meta.TransNames)
+	}
+	if meta.AlbumPicDocID != "" {
+		t.Fatalf("expected empty doc id, got %q", meta.AlbumPicDocID)
+	}
+}
+
+func TestMetaInfo_UnmarshalDj(t *testing.T) {
+	data := `{"programId":2062270373,"programName":"晚安电台 第12期","djName":"小明","radioName":"晚安电台",
+		"mainMusic":{"musicId":0,"musicName":"","artist":[],"album":"","format":"mp3","duration":1800000},
+		"createTime":1650000000000,"brand":"晚安电台","serial":12}`
+
+	var meta MetaInfo
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.MusicName != "晚安电台 第12期" || meta.Album != "晚安电台" || meta.Format != "mp3" || meta.Duration != 1800000 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	if !reflect.DeepEqual(meta.ArtistNames(), []string{"小明"}) {
+		t.Fatalf("unexpected artists %v", meta.ArtistNames())
+	}
+	if meta.Dj == nil || meta.Dj.ProgramID != 2062270373 || meta.Dj.DjName != "小明" {
+		t.Fatalf("unexpected dj info %+v", meta.Dj)
+	}
+}
+
+func TestNcmReader_DjLayout(t *testing.T) {
+	meta := &MetaInfo{
+		MusicName: "晚安",
+		Artist:    []NcmArtist{{Name: "小明"}},
+		Album:     "晚安电台",
+		Format:    "mp3",
+		Dj:        &NcmDjInfo{ProgramID: 1, ProgramName: "第12期", DjName: "小明", RadioName: "晚安电台"},
+	}
+	reader, err := NewNcmReader(bytes.NewReader(encodeTestNcm(t, testAudio(100), meta, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reader.Meta(), meta) {
+		t.Fatalf("meta mismatch\nwant %+v\ngot  %+v", meta, reader.Meta())
+	}
+}
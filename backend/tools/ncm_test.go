@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewNcmReader_NotNcm(t *testing.T) {
+	_, err := NewNcmReader(bytes.NewReader([]byte("ID3\x03\x00\x00\x00\x00\x00\x00")))
+	if !errors.Is(err, NotNcmFileErr) {
+		t.Fatalf("expected NotNcmFileErr, got %v", err)
+	}
+
+	_, err = NewNcmReader(bytes.NewReader([]byte("CTEN")))
+	if !errors.Is(err, NotNcmFileErr) {
+		t.Fatalf("expected NotNcmFileErr for short header, got %v", err)
+	}
+}
+
+func TestNewNcmReader_BadKey(t *testing.T) {
+	buf := bytes.NewBufferString("CTENFDAM")
+	buf.Write([]byte{0x01, 0x70})
+
+	// 声明长度为128的密钥 但只写入16字节
+	lenBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBuf, 128)
+	buf.Write(lenBuf)
+	buf.Write(make([]byte, 16))
+
+	_, err := NewNcmReader(bytes.NewReader(buf.Bytes()))
+	if !errors.Is(err, NcmBadKeyErr) {
+		t.Fatalf("expected NcmBadKeyErr, got %v", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected wrapped io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	// 密钥长度足够 但解密后不是合法的密钥
+	buf.Reset()
+	buf.WriteString("CTENFDAM")
+	buf.Write([]byte{0x01, 0x70})
+	binary.LittleEndian.PutUint32(lenBuf, 32)
+	buf.Write(lenBuf)
+	buf.Write(bytes.Repeat([]byte{0x11}, 32))
+
+	_, err = NewNcmReader(bytes.NewReader(buf.Bytes()))
+	if !errors.Is(err, NcmBadKeyErr) {
+		t.Fatalf("expected NcmBadKeyErr, got %v", err)
+	}
+}
+
+func TestNewNcmReader_OversizedLength(t *testing.T) {
+	data := encodeTestNcm(t, testAudio(100), &MetaInfo{MusicName: "晴天", Format: "mp3"}, nil)
+	keyOffset := 10
+	metaOffset := keyOffset + 4 + int(binary.LittleEndian.Uint32(data[keyOffset:]))
+	// crc32 和5字节的间隙之后是封面长度
+	imgOffset := metaOffset + 4 + int(binary.LittleEndian.Uint32(data[metaOffset:])) + 4 + 5
+
+	for _, tt := range []struct {
+		offset int
+		length uint32
+		kind   error
+	}{
+		{keyOffset, 0xfffffff0, NcmBadKeyErr},
+		{metaOffset, 0xffffffff, NcmBadMetaErr},
+		{imgOffset, 0xffffffff, NcmTruncatedErr},
+	} {
+		broken := append([]byte{}, data...)
+		binary.LittleEndian.PutUint32(broken[tt.offset:], tt.length)
+		_, err := NewNcmReader(bytes.NewReader(broken))
+		if !errors.Is(err, tt.kind) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("offset %d: expected %v, got %v", tt.offset, tt.kind, err)
+		}
+	}
+}
+
+func TestPKCS7UnPadding(t *testing.T) {
+	if _, err := PKCS7UnPadding(nil); err == nil {
+		t.Fatal("expected error for empty data")
+	}
+	if _, err := PKCS7UnPadding([]byte{1, 2, 3, 9}); err == nil {
+		t.Fatal("expected error for invalid padding")
+	}
+	res, err := PKCS7UnPadding([]byte{1, 2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, []byte{1, 2}) {
+		t.Fatalf("unexpected result %v", res)
+	}
+}
+
+func TestNcmReader_CheckCrc(t *testing.T) {
+	reader := &NcmReader{crcStored: 0x1234, crcComputed: 0x1234}
+	if err := reader.CheckCrc(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	reader.crcComputed = 0x4321
+	if err := reader.CheckCrc(); !errors.Is(err, NcmCrcErr) {
+		t.Fatalf("expected NcmCrcErr, got %v", err)
+	}
+}
+
+func TestProcessMusicFile_NcmCrc(t *testing.T) {
+	logger.InitLogger()
+	data := encodeTestNcm(t, append([]byte{0xff, 0xfb, 0x90, 0x64}, testAudio(100)...), &MetaInfo{MusicName: "晴天", Format: "mp3"}, nil)
+	// 元数据块开头的 "163 key(Don't modify):" 不参与解密 修改后只有crc32不一致
+	metaOffset := 10 + 4 + int(binary.LittleEndian.Uint32(data[10:]))
+	data[metaOffset+4] ^= 0x01
+	input := filepath.Join(t.TempDir(), "a.ncm")
+	if err := os.WriteFile(input, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultTransformOptions()
+	options.CrcCheck = configs.CrcCheckStrict
+	result := ProcessMusicFile(context.Background(), input, options)
+	if !errors.Is(result.Err, NcmCrcErr) {
+		t.Fatalf("strict: expected NcmCrcErr, got %v", result.Err)
+	}
+
+	options.CrcCheck = configs.CrcCheckLenient
+	result = ProcessMusicFile(context.Background(), input, options)
+	if !result.Success() {
+		t.Fatalf("lenient: %v", result.Err)
+	}
+	if len(result.Warnings) != 1 || !strings.HasPrefix(result.Warnings[0], NcmCrcErr.Error()) {
+		t.Fatalf("lenient: expected crc warning, got %v", result.Warnings)
+	}
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+)
+
+// NcmWriter NCM编码器 写入文件头后 Write 写入的音频数据会被加密
+// 与 NcmReader 使用相同的密钥和密钥流 主要用于生成测试文件
+type NcmWriter struct {
+	w      io.Writer
+	cipher *ncmCipher
+	offset int64
+}
+
+// NewNcmWriter 写入NCM文件头 key 为空时随机生成, meta 为空时不写入元数据, cover 为空时不写入封面
+func NewNcmWriter(w io.Writer, key []byte, meta *MetaInfo, cover []byte) (*NcmWriter, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	keyBlock, err := encodeNcmKey(key)
+	if err != nil {
+		return nil, err
+	}
+	metaBlock, err := encodeNcmMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("CTENFDAM")
+	// 2字节的版本信息
+	buf.Write([]byte{0x01, 0x70})
+	buf.Write(keyBlock)
+	buf.Write(metaBlock)
+	writeUint32(buf, crc32.ChecksumIEEE(append(append([]byte{}, keyBlock...), metaBlock...)))
+	// 5字节的间隙
+	buf.Write(make([]byte, 5))
+	writeUint32(buf, uint32(len(cover)))
+	buf.Write(cover)
+
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return &NcmWriter{
+		w:      w,
+		cipher: newNcmCipher(key),
+	}, nil
+}
+
+// Write 加密并写入音频数据 不修改p
+func (n *NcmWriter) Write(p []byte) (int, error) {
+	buf := append([]byte{}, p...)
+	// 密钥流异或 加密和解密相同
+	n.cipher.Decrypt(buf, n.offset)
+	c, err := n.w.Write(buf)
+	n.offset += int64(c)
+	return c, err
+}
+
+// encodeNcmKey 返回包含长度字段的密钥块
+func encodeNcmKey(key []byte) ([]byte, error) {
+	data, err := encryptAes128Ecb(aesCoreKey, append([]byte("neteasecloudmusic"), key...))
+	if err != nil {
+		return nil, err
+	}
+	for i := range data {
+		data[i] ^= 0x64
+	}
+	buf := &bytes.Buffer{}
+	writeUint32(buf, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// encodeNcmMeta 返回包含长度字段的元数据块
+func encodeNcmMeta(meta *MetaInfo) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if meta == nil {
+		writeUint32(buf, 0)
+		return buf.Bytes(), nil
+	}
+
+	prefix := "music:"
+	var v interface{} = meta
+	// 电台节目的歌曲信息放在 mainMusic 中
+	if meta.Dj != nil {
+		mainMusic := *meta
+		mainMusic.Dj = nil
+		prefix = "dj:"
+		v = map[string]interface{}{
+			"mainMusic":   mainMusic,
+			"programId":   meta.Dj.ProgramID,
+			"programName": meta.Dj.ProgramName,
+			"djName":      meta.Dj.DjName,
+			"radioName":   meta.Dj.RadioName,
+		}
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptAes128Ecb(aesModifyKey, append([]byte(prefix), body...))
+	if err != nil {
+		return nil, err
+	}
+	data := []byte("163 key(Don't modify):" + base64.StdEncoding.EncodeToString(encrypted))
+	for i := range data {
+		data[i] ^= 0x63
+	}
+	writeUint32(buf, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+func PKCS7Padding(src []byte, blockSize int) []byte {
+	padding := blockSize - len(src)%blockSize
+	return append(src, bytes.Repeat([]byte{byte(padding)}, padding)...)
+}
+
+func encryptAes128Ecb(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = PKCS7Padding(append([]byte{}, data...), block.BlockSize())
+	encrypted := make([]byte, len(data))
+	bs := block.BlockSize()
+	for i := 0; i < len(data); i += bs {
+		block.Encrypt(encrypted[i:i+bs], data[i:i+bs])
+	}
+	return encrypted, nil
+}
+
+func writeUint32(w io.Writer, v uint32) {
+	var wBuf [4]byte
+	binary.LittleEndian.PutUint32(wBuf[:], v)
+	w.Write(wBuf[:])
+}
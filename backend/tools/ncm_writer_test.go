@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/bogem/id3v2"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// encodeTestNcm 生成NCM文件内容
+func encodeTestNcm(t testing.TB, audio []byte, meta *MetaInfo, cover []byte) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewNcmWriter(buf, nil, meta, cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(audio); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testAudio(size int) []byte {
+	audio := make([]byte, size)
+	for i := range audio {
+		audio[i] = byte(i * 7)
+	}
+	return audio
+}
+
+func TestNcmWriter_RoundTrip(t *testing.T) {
+	meta := &MetaInfo{
+		MusicID:       186001,
+		MusicName:     "晴天",
+		Artist:        []NcmArtist{{Name: "周杰伦", ID: 6452}},
+		AlbumID:       18905,
+		Album:         "叶惠美",
+		AlbumPicDocID: "109951163",
+		BitRate:       320000,
+		Duration:      269000,
+		Alias:         []string{"Sunny Day"},
+		TransNames:    []string{"晴朗的日子"},
+		Format:        "mp3",
+	}
+
+	cases := []struct {
+		name  string
+		size  int
+		meta  *MetaInfo
+		cover []byte
+	}{
+		{"one byte", 1, meta, testJpeg},
+		{"odd length", 0x8000*3 + 17, meta, testJpeg},
+		{"box boundary", 255, meta, nil},
+		{"box boundary +1", 257, meta, nil},
+		{"no metadata", 1024, nil, testPng},
+		{"empty metadata", 1024, &MetaInfo{}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			audio := testAudio(c.size)
+			data := encodeTestNcm(t, audio, c.meta, c.cover)
+
+			reader, err := NewNcmReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = reader.CheckCrc(); err != nil {
+				t.Fatal(err)
+			}
+			if reader.AudioSize() != int64(c.size) {
+				t.Fatalf("expected audio size %d, got %d", c.size, reader.AudioSize())
+			}
+			if !bytes.Equal(reader.Cover(), c.cover) {
+				t.Fatal("cover mismatch")
+			}
+			want := MetaInfo{}
+			if c.meta != nil {
+				want = *c.meta
+			}
+			if !reflect.DeepEqual(*reader.Meta(), want) {
+				t.Fatalf("meta mismatch\nwant %+v\ngot  %+v", want, *reader.Meta())
+			}
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, audio) {
+				t.Fatal("decrypted audio mismatch")
+			}
+		})
+	}
+}
+
+func TestNcmWriter_ChunkedWrite(t *testing.T) {
+	audio := testAudio(4099)
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	whole := &bytes.Buffer{}
+	w, _ := NewNcmWriter(whole, key, nil, nil)
+	w.Write(audio)
+
+	chunked := &bytes.Buffer{}
+	w, _ = NewNcmWriter(chunked, key, nil, nil)
+	for i := 0; i < len(audio); i += 333 {
+		end := i + 333
+		if end > len(audio) {
+			end = len(audio)
+		}
+		w.Write(audio[i:end])
+	}
+	if !bytes.Equal(whole.Bytes(), chunked.Bytes()) {
+		t.Fatal("chunked write differs from single write")
+	}
+}
+
+func TestNcmReader_Errors(t *testing.T) {
+	// 没有音频数据
+	data := encodeTestNcm(t, nil, nil, nil)
+	if _, err := NewNcmReader(bytes.NewReader(data)); !errors.Is(err, NcmTruncatedErr) {
+		t.Fatalf("expected NcmTruncatedErr, got %v", err)
+	}
+
+	// 修改文件中记录的crc32 音频(16) 封面长度(4) 间隙(5) 之前是crc32
+	data = encodeTestNcm(t, testAudio(16), &MetaInfo{MusicName: "a"}, nil)
+	data[len(data)-16-4-5-4] ^= 0x01
+	reader, err := NewNcmReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reader.CheckCrc(); !errors.Is(err, NcmCrcErr) {
+		t.Fatalf("expected NcmCrcErr, got %v", err)
+	}
+}
+
+func TestProcessMusicFile_Ncm(t *testing.T) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	audio := testAudio(5000)
+	input := filepath.Join(dir, "a.ncm")
+	meta := &MetaInfo{MusicName: "晴天", Album: "叶惠美", Artist: []NcmArtist{{Name: "周杰伦", ID: 6452}}, Format: "mp3"}
+	if err := os.WriteFile(input, encodeTestNcm(t, audio, meta, testJpeg), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultTransformOptions()
+	options.NameTemplate = "{artist} - {title}.{ext}"
+	result := ProcessMusicFile(context.Background(), input, options)
+	if !result.Success() {
+		t.Fatal(result.Err)
+	}
+	if result.Decryptor != "ncm" || result.Format != "mp3" || len(result.Warnings) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if want := filepath.Join(dir, "周杰伦 - 晴天.mp3"); result.Output != want {
+		t.Fatalf("expected %s, got %s", want, result.Output)
+	}
+
+	tag, err := id3v2.Open(result.Output, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Title() != "晴天" || tag.Artist() != "周杰伦" {
+		t.Fatalf("unexpected tag %s %s", tag.Title(), tag.Artist())
+	}
+	if len(tag.GetFrames(tag.CommonID("Attached picture"))) != 1 {
+		t.Fatal("expected embedded cover")
+	}
+
+	// 去掉标签后与原始音频一致
+	tagged, err := os.ReadFile(result.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tagged[tag.Size():], audio) {
+		t.Fatal("decrypted audio mismatch")
+	}
+}
@@ -0,0 +1,211 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 整理冲突原因
+const (
+	// 目标位置已有其他文件
+	OrganizeConflictExist = "exist"
+	// 多个文件整理到同一个位置
+	OrganizeConflictDuplicate = "duplicate"
+)
+
+// OrganizeMove 一个文件的整理方案
+type OrganizeMove struct {
+	Source   string   `json:"source"`
+	Target   string   `json:"target"`
+	Tag      AudioTag `json:"tag"`
+	Conflict string   `json:"conflict"`
+	// 读取标签或移动失败的原因
+	Error string `json:"error"`
+}
+
+// Movable 没有冲突和错误 可以移动
+func (m OrganizeMove) Movable() bool {
+	return m.Conflict == "" && m.Error == "" && m.Target != ""
+}
+
+// OrganizePlan 整理预览 不会修改任何文件
+type OrganizePlan struct {
+	Root  string         `json:"root"`
+	Moves []OrganizeMove `json:"moves"`
+	// 已经在目标位置的文件数
+	Unchanged int `json:"unchanged"`
+	Conflicts int `json:"conflicts"`
+}
+
+// OrganizeResult 执行整理的结果
+type OrganizeResult struct {
+	// 用于撤销 没有移动任何文件时为空
+	BatchID string         `json:"batch_id"`
+	Moved   int            `json:"moved"`
+	Skipped int            `json:"skipped"`
+	Failed  []OrganizeMove `json:"failed"`
+}
+
+// PlanOrganize 扫描目录下的mp3和flac 按标签生成 Artist/Album/NN Title.ext 的整理方案
+func PlanOrganize(ctx context.Context, root string, options ScanOptions) (*OrganizePlan, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	plan := &OrganizePlan{
+		Root:  root,
+		Moves: make([]OrganizeMove, 0),
+	}
+	err = scanFiles(ctx, root, options, IsTaggableAudio, func(path string, info fs.FileInfo) error {
+		move := OrganizeMove{Source: path}
+		tag, err := ReadAudioTag(path)
+		if err != nil {
+			move.Error = err.Error()
+		} else {
+			move.Tag = tag
+			move.Target = organizeTarget(root, path, tag)
+			if move.Target == path {
+				plan.Unchanged++
+				return nil
+			}
+		}
+		plan.Moves = append(plan.Moves, move)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Conflicts = detectOrganizeConflicts(plan.Moves)
+	return plan, nil
+}
+
+// organizeTarget Artist/Album/NN Title.ext 优先使用专辑歌手 没有音轨号时省略 NN
+func organizeTarget(root, path string, tag AudioTag) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	artist := sanitizeFileName(tag.AlbumArtist)
+	if artist == "" {
+		artist = sanitizeFileName(tag.Artist)
+	}
+	if artist == "" {
+		artist = "Unknown Artist"
+	}
+	album := sanitizeFileName(tag.Album)
+	if album == "" {
+		album = "Unknown Album"
+	}
+	title := tag.Title
+	if strings.TrimSpace(title) == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if tag.Track > 0 {
+		title = fmt.Sprintf("%02d %s", tag.Track, title)
+	}
+	return filepath.Join(root, artist, album, sanitizeBaseName(title, ext))
+}
+
+// detectOrganizeConflicts 标记目标已存在和目标重复的文件 返回冲突数
+func detectOrganizeConflicts(moves []OrganizeMove) int {
+	// 不区分大小写 兼容 windows 和 macOS
+	targets := make(map[string][]int)
+	for i, move := range moves {
+		if move.Target != "" {
+			key := strings.ToLower(move.Target)
+			targets[key] = append(targets[key], i)
+		}
+	}
+
+	conflicts := 0
+	for _, indexes := range targets {
+		conflict := ""
+		move := moves[indexes[0]]
+		if len(indexes) > 1 {
+			conflict = OrganizeConflictDuplicate
+		} else if _, err := os.Lstat(move.Target); err == nil && !strings.EqualFold(move.Source, move.Target) {
+			// 只有大小写不同时是同一个文件
+			conflict = OrganizeConflictExist
+		}
+		if conflict == "" {
+			continue
+		}
+		for _, i := range indexes {
+			moves[i].Conflict = conflict
+			conflicts++
+		}
+	}
+	return conflicts
+}
+
+// ApplyOrganize 执行整理方案 有冲突或错误的文件跳过 每移动一个文件写一条撤销记录
+// 执行前重新检查目标位置 不会覆盖已有文件
+func ApplyOrganize(ctx context.Context, plan *OrganizePlan, journal *OrganizeJournal) (OrganizeResult, error) {
+	result := OrganizeResult{Failed: make([]OrganizeMove, 0)}
+	batch, err := journal.Begin(plan.Root)
+	if err != nil {
+		return result, err
+	}
+
+	for _, move := range plan.Moves {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if !move.Movable() {
+			result.Skipped++
+			continue
+		}
+		if err := organizeMove(move.Source, move.Target); err != nil {
+			logger.Error(fmt.Sprintf("organize %s failed: %v", move.Source, err))
+			move.Error = err.Error()
+			result.Failed = append(result.Failed, move)
+			continue
+		}
+		if err := batch.Record(move.Source, move.Target); err != nil {
+			// 记录失败时移回去 保证所有移动都能撤销
+			if rollbackErr := organizeMove(move.Target, move.Source); rollbackErr != nil {
+				logger.Error(fmt.Sprintf("rollback %s failed: %v", move.Target, rollbackErr))
+			}
+			move.Error = err.Error()
+			result.Failed = append(result.Failed, move)
+			continue
+		}
+		removeEmptyDirs(filepath.Dir(move.Source), plan.Root)
+		result.Moved++
+	}
+
+	if result.Moved > 0 {
+		result.BatchID = batch.ID
+	} else {
+		batch.Discard()
+	}
+	return result, err
+}
+
+// organizeMove 目标已存在时返回 OutputExistErr
+func organizeMove(source, target string) error {
+	// 只有大小写不同时直接重命名
+	if _, err := os.Lstat(target); err == nil && !strings.EqualFold(source, target) {
+		return OutputExistErr
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	return moveFile(source, target)
+}
+
+// removeEmptyDirs 删除 dir 到 root 之间的空目录 不删除 root
+func removeEmptyDirs(dir, root string) {
+	for {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
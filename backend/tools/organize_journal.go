@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var OrganizeBatchNotFoundErr = errors.New("organize batch not found")
+
+// DefaultOrganizeJournalName 整理的撤销记录目录 放在 ~/.tools_collection 下
+var DefaultOrganizeJournalName = "organize"
+
+const organizeJournalExt = ".jsonl"
+
+// OrganizeRecord 一次移动 第一行只记录整理的根目录
+type OrganizeRecord struct {
+	Root   string `json:"root,omitempty"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Time   int64  `json:"time"` // 秒
+}
+
+// OrganizeBatchInfo 一次整理的撤销记录
+type OrganizeBatchInfo struct {
+	ID    string `json:"id"`
+	Root  string `json:"root"`
+	Moved int    `json:"moved"`
+	Time  int64  `json:"time"` // 开始时间 秒
+}
+
+// OrganizeJournal 每次整理一个文件 每行一条JSON 移动一个文件追加一行
+// 程序中途退出时已移动的文件也能撤销
+type OrganizeJournal struct {
+	dir string
+}
+
+// NewOrganizeJournal dir 为空时使用 ~/.tools_collection/organize
+func NewOrganizeJournal(dir string) *OrganizeJournal {
+	if dir == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(homeDir, ".tools_collection", DefaultOrganizeJournalName)
+		}
+	}
+	return &OrganizeJournal{dir: dir}
+}
+
+// OrganizeBatch 正在写入的一次整理
+type OrganizeBatch struct {
+	ID   string
+	mux  sync.Mutex
+	path string
+}
+
+// Begin 开始一次整理
+func (j *OrganizeJournal) Begin(root string) (*OrganizeBatch, error) {
+	if err := os.MkdirAll(j.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	id := uuid.NewString()
+	batch := &OrganizeBatch{ID: id, path: filepath.Join(j.dir, id+organizeJournalExt)}
+	return batch, batch.append(OrganizeRecord{Root: root, Time: time.Now().Unix()})
+}
+
+// Record 记录一次已完成的移动
+func (b *OrganizeBatch) Record(source, target string) error {
+	return b.append(OrganizeRecord{Source: source, Target: target, Time: time.Now().Unix()})
+}
+
+// Discard 没有移动任何文件时删除记录
+func (b *OrganizeBatch) Discard() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	os.Remove(b.path)
+}
+
+func (b *OrganizeBatch) append(record OrganizeRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	fp, err := os.OpenFile(b.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = fp.Write(append(line, '\n')); err != nil {
+		fp.Close()
+		return err
+	}
+	// 确保移动之后记录已写入磁盘
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// List 所有可以撤销的整理 按时间倒序
+func (j *OrganizeJournal) List() ([]OrganizeBatchInfo, error) {
+	entries, err := os.ReadDir(j.dir)
+	if os.IsNotExist(err) {
+		return []OrganizeBatchInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	batches := make([]OrganizeBatchInfo, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), organizeJournalExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		records, err := j.read(id)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		batches = append(batches, OrganizeBatchInfo{
+			ID:    id,
+			Root:  records[0].Root,
+			Moved: len(records) - 1,
+			Time:  records[0].Time,
+		})
+	}
+	sort.SliceStable(batches, func(i, k int) bool {
+		return batches[i].Time > batches[k].Time
+	})
+	return batches, nil
+}
+
+// Undo 按相反顺序把文件移回原来的位置 原位置已有文件或整理后的文件不存在时跳过
+// 全部恢复后删除记录 否则只保留未恢复的移动 返回恢复的文件数
+func (j *OrganizeJournal) Undo(id string) (int, error) {
+	records, err := j.read(id)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, OrganizeBatchNotFoundErr
+	}
+	head, moves := records[0], records[1:]
+
+	restored := 0
+	remaining := make([]OrganizeRecord, 0)
+	errs := make([]error, 0)
+	for i := len(moves) - 1; i >= 0; i-- {
+		move := moves[i]
+		if err = organizeMove(move.Target, move.Source); err != nil {
+			errs = append(errs, fmt.Errorf("restore %s failed: %w", move.Source, err))
+			remaining = append(remaining, move)
+			continue
+		}
+		removeEmptyDirs(filepath.Dir(move.Target), head.Root)
+		restored++
+	}
+
+	path := filepath.Join(j.dir, id+organizeJournalExt)
+	if len(remaining) == 0 {
+		return restored, os.Remove(path)
+	}
+	// 保留未恢复的移动 按原来的顺序 可以处理后再次撤销
+	for l, r := 0, len(remaining)-1; l < r; l, r = l+1, r-1 {
+		remaining[l], remaining[r] = remaining[r], remaining[l]
+	}
+	buf := &strings.Builder{}
+	for _, record := range append([]OrganizeRecord{head}, remaining...) {
+		line, _ := json.Marshal(record)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err = os.WriteFile(path, []byte(buf.String()), 0666); err != nil {
+		errs = append(errs, err)
+	}
+	return restored, errors.Join(errs...)
+}
+
+func (j *OrganizeJournal) read(id string) ([]OrganizeRecord, error) {
+	// id 只能是记录目录下的文件名
+	if id == "" || filepath.Base(id) != id || id == "." || id == ".." {
+		return nil, OrganizeBatchNotFoundErr
+	}
+	fp, err := os.Open(filepath.Join(j.dir, id+organizeJournalExt))
+	if os.IsNotExist(err) {
+		return nil, OrganizeBatchNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	records := make([]OrganizeRecord, 0)
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		var record OrganizeRecord
+		// 忽略写入中断导致的不完整的行
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Debug(fmt.Sprintf("skip broken organize journal line: %v", err))
+			continue
+		}
+		if len(records) > 0 && (record.Source == "" || record.Target == "") {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
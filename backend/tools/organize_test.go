@@ -0,0 +1,188 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/bogem/id3v2"
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestMP3(t *testing.T, path string, frames map[string]string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	for id, text := range frames {
+		tag.AddTextFrame(id, id3v2.EncodingUTF8, text)
+	}
+	if err = tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestFLAC(t *testing.T, path string, comments map[string]string) {
+	data := append([]byte("fLaC"), 0x80, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	data = append(data, 0xff, 0xf8, 0x69, 0x08, 0x00)
+	f, err := flac.ParseBytes(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmts := flacvorbis.New()
+	for field, value := range comments {
+		cmts.Add(field, value)
+	}
+	block := cmts.Marshal()
+	f.Meta = append(f.Meta, &block)
+	if err = f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadAudioTag(t *testing.T) {
+	dir := t.TempDir()
+	mp3 := filepath.Join(dir, "a.mp3")
+	writeTestMP3(t, mp3, map[string]string{
+		"TIT2": "晴天",
+		"TPE1": "周杰伦\x00杨瑞代",
+		"TALB": "叶惠美",
+		"TRCK": "3/11",
+	})
+	tag, err := ReadAudioTag(mp3)
+	want := AudioTag{Title: "晴天", Artist: "周杰伦, 杨瑞代", Album: "叶惠美", Track: 3}
+	if err != nil || tag != want {
+		t.Fatalf("expected %+v, got %+v %v", want, tag, err)
+	}
+
+	slash := filepath.Join(dir, "b.mp3")
+	writeTestMP3(t, slash, map[string]string{"TIT2": "Thunderstruck", "TPE1": "AC/DC"})
+	tag, err = ReadAudioTag(slash)
+	want = AudioTag{Title: "Thunderstruck", Artist: "AC/DC"}
+	if err != nil || tag != want {
+		t.Fatalf("expected %+v, got %+v %v", want, tag, err)
+	}
+
+	flacPath := filepath.Join(dir, "a.flac")
+	writeTestFLAC(t, flacPath, map[string]string{
+		flacvorbis.FIELD_TITLE:       "七里香",
+		flacvorbis.FIELD_ARTIST:      "周杰伦",
+		"ALBUMARTIST":                "Jay Chou",
+		flacvorbis.FIELD_ALBUM:       "七里香",
+		flacvorbis.FIELD_TRACKNUMBER: "02",
+	})
+	tag, err = ReadAudioTag(flacPath)
+	want = AudioTag{Title: "七里香", Artist: "周杰伦", AlbumArtist: "Jay Chou", Album: "七里香", Track: 2}
+	if err != nil || tag != want {
+		t.Fatalf("expected %+v, got %+v %v", want, tag, err)
+	}
+
+	if _, err = ReadAudioTag(filepath.Join(dir, "a.ogg")); !errors.Is(err, UnsupportedAudioErr) {
+		t.Fatalf("expected UnsupportedAudioErr, got %v", err)
+	}
+}
+
+func TestOrganize(t *testing.T) {
+	logger.InitLogger()
+	root := t.TempDir()
+	journal := NewOrganizeJournal(filepath.Join(t.TempDir(), DefaultOrganizeJournalName))
+
+	sunny := map[string]string{"TIT2": "晴天", "TPE1": "周杰伦", "TALB": "叶惠美", "TRCK": "3"}
+	writeTestMP3(t, filepath.Join(root, "download", "晴天.mp3"), sunny)
+	// 标签相同的两个文件
+	writeTestMP3(t, filepath.Join(root, "a", "dup.mp3"), map[string]string{"TIT2": "双截棍", "TPE1": "周杰伦", "TALB": "范特西"})
+	writeTestMP3(t, filepath.Join(root, "b", "dup.mp3"), map[string]string{"TIT2": "双截棍", "TPE1": "周杰伦", "TALB": "范特西"})
+	// 目标位置已有其他文件
+	rice := map[string]string{"TIT2": "稻香", "TPE1": "周杰伦", "TALB": "魔杰座"}
+	writeTestMP3(t, filepath.Join(root, "稻香.mp3"), rice)
+	writeTestMP3(t, filepath.Join(root, "周杰伦", "魔杰座", "稻香.mp3"), rice)
+	// 已经整理好的文件和没有标签的文件
+	writeTestMP3(t, filepath.Join(root, "周杰伦", "叶惠美", "01 以父之名.mp3"), map[string]string{"TIT2": "以父之名", "TPE1": "周杰伦", "TALB": "叶惠美", "TRCK": "1"})
+	writeTestMP3(t, filepath.Join(root, "untagged.mp3"), nil)
+
+	plan, err := PlanOrganize(context.Background(), root, ScanOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := make(map[string]OrganizeMove)
+	for _, move := range plan.Moves {
+		rel, _ := filepath.Rel(root, move.Source)
+		targets[filepath.ToSlash(rel)] = move
+	}
+	wantTargets := map[string]string{
+		"download/晴天.mp3": "周杰伦/叶惠美/03 晴天.mp3",
+		"a/dup.mp3":       "周杰伦/范特西/双截棍.mp3",
+		"b/dup.mp3":       "周杰伦/范特西/双截棍.mp3",
+		"稻香.mp3":          "周杰伦/魔杰座/稻香.mp3",
+		"untagged.mp3":    "Unknown Artist/Unknown Album/untagged.mp3",
+	}
+	if len(targets) != len(wantTargets) || plan.Unchanged != 2 || plan.Conflicts != 3 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	for source, want := range wantTargets {
+		rel, _ := filepath.Rel(root, targets[source].Target)
+		if filepath.ToSlash(rel) != want {
+			t.Fatalf("%s: expected %s, got %s", source, want, rel)
+		}
+	}
+	for source, conflict := range map[string]string{
+		"a/dup.mp3": OrganizeConflictDuplicate,
+		"b/dup.mp3": OrganizeConflictDuplicate,
+		"稻香.mp3":    OrganizeConflictExist,
+	} {
+		if targets[source].Conflict != conflict {
+			t.Fatalf("%s: expected conflict %s, got %+v", source, conflict, targets[source])
+		}
+	}
+
+	result, err := ApplyOrganize(context.Background(), plan, journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Moved != 2 || result.Skipped != 3 || len(result.Failed) != 0 || result.BatchID == "" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if _, err = os.Stat(filepath.Join(root, "周杰伦", "叶惠美", "03 晴天.mp3")); err != nil {
+		t.Fatal(err)
+	}
+	// 移走后的空目录被删除
+	if _, err = os.Stat(filepath.Join(root, "download")); !os.IsNotExist(err) {
+		t.Fatalf("expected empty dir removed, got %v", err)
+	}
+
+	batches, err := journal.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 1 || batches[0].ID != result.BatchID || batches[0].Root != plan.Root || batches[0].Moved != 2 {
+		t.Fatalf("unexpected batches %+v", batches)
+	}
+
+	restored, err := journal.Undo(result.BatchID)
+	if err != nil || restored != 2 {
+		t.Fatalf("expected 2 restored, got %d %v", restored, err)
+	}
+	for _, path := range []string{"download/晴天.mp3", "untagged.mp3"} {
+		if _, err = os.Stat(filepath.Join(root, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(root, "Unknown Artist")); !os.IsNotExist(err) {
+		t.Fatalf("expected organized dir removed, got %v", err)
+	}
+	if _, err = journal.Undo(result.BatchID); !errors.Is(err, OrganizeBatchNotFoundErr) {
+		t.Fatalf("expected OrganizeBatchNotFoundErr, got %v", err)
+	}
+}
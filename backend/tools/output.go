@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/configs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// OutputExistErr 输出文件已存在
+var OutputExistErr = errors.New("output file already exists")
+
+// DefaultNameTemplate 默认与源文件同名
+var DefaultNameTemplate = "{name}.{ext}"
+
+var (
+	templateVarRegexp  = regexp.MustCompile(`\{(\w+)\}`)
+	leadingTrackRegexp = regexp.MustCompile(`^(\d{1,3})[\s._-]`)
+)
+
+// 单个文件名的最大字节数 大部分文件系统限制为255
+const maxFileNameBytes = 200
+
+// BuildOutputPath 根据输出目录和文件名模板生成输出路径
+// 模板支持 {artist} {album} {track} {title} {name} {ext}, 可以用 "/" 分隔子目录
+func BuildOutputPath(input string, meta *MetaInfo, format string, options *TransformOptions) string {
+	if meta == nil {
+		meta = &MetaInfo{}
+	}
+	dir := options.OutputDir
+	if dir == "" {
+		dir = filepath.Dir(input)
+	}
+	tpl := options.NameTemplate
+	if tpl == "" {
+		tpl = DefaultNameTemplate
+	}
+
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	values := map[string]string{
+		"artist": strings.Join(meta.ArtistNames(), ", "),
+		"album":  meta.Album,
+		"title":  meta.MusicName,
+		"track":  "",
+		"name":   name,
+		"ext":    format,
+	}
+	if values["artist"] == "" {
+		values["artist"] = "Unknown Artist"
+	}
+	if values["album"] == "" {
+		values["album"] = "Unknown Album"
+	}
+	if values["title"] == "" {
+		values["title"] = name
+	}
+	if match := leadingTrackRegexp.FindStringSubmatch(name); match != nil {
+		track, _ := strconv.Atoi(match[1])
+		values["track"] = fmt.Sprintf("%02d", track)
+	}
+
+	rendered := templateVarRegexp.ReplaceAllStringFunc(tpl, func(s string) string {
+		key := s[1 : len(s)-1]
+		value, ok := values[key]
+		if !ok {
+			return s
+		}
+		// 变量中的路径分隔符不能产生新的目录
+		return strings.NewReplacer("/", "_", "\\", "_").Replace(value)
+	})
+
+	segments := strings.Split(filepath.ToSlash(rendered), "/")
+	parts := make([]string, 0, len(segments)+1)
+	parts = append(parts, dir)
+	for i, segment := range segments {
+		if i == len(segments)-1 {
+			segment = sanitizeBaseName(segment, format)
+		} else {
+			segment = sanitizeFileName(segment)
+		}
+		if segment == "" {
+			continue
+		}
+		parts = append(parts, segment)
+	}
+	return filepath.Join(parts...)
+}
+
+// sanitizeBaseName 处理最后一段文件名 保证以 .ext 结尾
+func sanitizeBaseName(segment, ext string) string {
+	base := strings.TrimSuffix(segment, "."+ext)
+	base = sanitizeFileName(base)
+	if base == "" {
+		base = "Unknown"
+	}
+	return base + "." + ext
+}
+
+// sanitizeFileName 替换文件系统不允许的字符 去掉首尾多余的分隔符 并限制长度
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	// 模板中缺失的变量会留下 " - " 之类的分隔符
+	name = strings.Trim(name, " -_")
+	// windows 不允许以 "." 或空格结尾
+	name = strings.TrimRight(name, ". ")
+	if name == "." || name == ".." {
+		return ""
+	}
+
+	if len(name) > maxFileNameBytes {
+		name = name[:maxFileNameBytes]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+	}
+	return name
+}
+
+// createOutputFile 按冲突策略创建输出文件 skip 策略下文件已存在时返回 OutputExistErr
+func createOutputFile(path, policy string) (*os.File, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, "", err
+	}
+
+	switch policy {
+	case configs.ConflictOverwrite:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+		return file, path, err
+	case configs.ConflictRename:
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		candidate := path
+		for i := 1; ; i++ {
+			file, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+			if err == nil {
+				return file, candidate, nil
+			}
+			if !os.IsExist(err) {
+				return nil, "", err
+			}
+			candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+	default:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			return nil, path, OutputExistErr
+		}
+		return file, path, err
+	}
+}
@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"errors"
+	"github.com/wanyuqin/tool-collection/configs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildOutputPath(t *testing.T) {
+	meta := &MetaInfo{
+		MusicName: "晴天",
+		Album:     "叶惠美",
+		Artist:    []NcmArtist{{Name: "周杰伦", ID: 6452}},
+	}
+	options := &TransformOptions{
+		OutputDir:    "/music",
+		NameTemplate: "{artist}/{album}/{track} - {title}.{ext}",
+	}
+
+	got := BuildOutputPath("/src/03 晴天.ncm", meta, "flac", options)
+	want := filepath.Join("/music", "周杰伦", "叶惠美", "03 - 晴天.flac")
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	// 没有音轨号时不能留下多余的分隔符
+	got = BuildOutputPath("/src/晴天.ncm", meta, "flac", options)
+	want = filepath.Join("/music", "周杰伦", "叶惠美", "晴天.flac")
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestBuildOutputPathDefault(t *testing.T) {
+	// 路径中出现 ".ncm" 不影响输出文件名
+	got := BuildOutputPath("/a.ncm/b.ncm.ncm", nil, "mp3", &TransformOptions{})
+	want := filepath.Join("/a.ncm", "b.ncm.mp3")
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestBuildOutputPathSanitize(t *testing.T) {
+	meta := &MetaInfo{
+		MusicName: `What? A/B: "C"`,
+		Album:     "..",
+		Artist:    []NcmArtist{{Name: "AC/DC"}, {}},
+	}
+	options := &TransformOptions{
+		OutputDir:    "/music",
+		NameTemplate: "{artist}/{album}/{title}.{ext}",
+	}
+
+	got := BuildOutputPath("/src/a.ncm", meta, "mp3", options)
+	want := filepath.Join("/music", "AC_DC", `What_ A_B_ _C.mp3`)
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestCreateOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "a.mp3")
+
+	fp, out, err := createOutputFile(path, configs.ConflictSkip)
+	if err != nil || out != path {
+		t.Fatalf("create failed: %s %v", out, err)
+	}
+	fp.Close()
+
+	if _, _, err = createOutputFile(path, configs.ConflictSkip); !errors.Is(err, OutputExistErr) {
+		t.Fatalf("expected OutputExistErr, got %v", err)
+	}
+
+	fp, out, err = createOutputFile(path, configs.ConflictRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+	if want := filepath.Join(dir, "sub", "a (1).mp3"); out != want {
+		t.Fatalf("expected %s, got %s", want, out)
+	}
+
+	if err = os.WriteFile(path, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fp, out, err = createOutputFile(path, configs.ConflictOverwrite)
+	if err != nil || out != path {
+		t.Fatalf("overwrite failed: %s %v", out, err)
+	}
+	fp.Close()
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("expected truncated file, got %q", data)
+	}
+}
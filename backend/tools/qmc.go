@@ -0,0 +1,460 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+var QmcKeyErr = errors.New("qmc key is invalid")
+
+var qmcFormats = map[string]string{
+	".qmc0":    "mp3",
+	".qmc3":    "mp3",
+	".qmcflac": "flac",
+	".qmcogg":  "ogg",
+	".mflac":   "flac",
+}
+
+// qmcDecryptor QQ音乐 .qmc0 .qmc3 .qmcflac .qmcogg .mflac
+// 文件末尾带有密钥的使用 map 或 rc4 密钥流 否则使用固定的密钥流
+type qmcDecryptor struct {
+}
+
+func NewQmcDecryptor() Decryptor {
+	return &qmcDecryptor{}
+}
+
+func (d *qmcDecryptor) Name() string {
+	return "qmc"
+}
+
+func (d *qmcDecryptor) Extensions() []string {
+	exts := make([]string, 0, len(qmcFormats))
+	for ext := range qmcFormats {
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+func (d *qmcDecryptor) Match(header []byte) bool {
+	return false
+}
+
+func (d *qmcDecryptor) Open(r io.ReadSeeker, name string) (DecryptedAudio, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	size, err := seekSize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, audioSize, err := readQmcTail(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var cipher streamCipher
+	switch {
+	case len(key) > 300:
+		cipher = newQmcRC4Cipher(key)
+	case len(key) > 0:
+		cipher = newQmcMapCipher(key)
+	case ext == ".mflac":
+		return nil, fmt.Errorf("%w: key is not embedded", QmcKeyErr)
+	default:
+		cipher = qmcStaticCipher{}
+	}
+
+	return &decryptedStream{
+		Reader: newCipherReader(io.LimitReader(r, audioSize), cipher),
+		size:   audioSize,
+		format: qmcFormats[ext],
+	}, nil
+}
+
+// readQmcTail 读取文件末尾的密钥 返回密钥以及音频数据大小 没有密钥时返回nil
+func readQmcTail(r io.ReadSeeker, size int64) ([]byte, int64, error) {
+	if size < 8 {
+		return nil, size, nil
+	}
+	tail := make([]byte, 8)
+	if _, err := r.Seek(size-8, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		rawKey    []byte
+		audioSize int64
+	)
+	switch string(tail[4:]) {
+	case "QTag":
+		// [key,songId,version] + 4字节大端长度 + "QTag"
+		tagLen := int64(binary.BigEndian.Uint32(tail[:4]))
+		audioSize = size - 8 - tagLen
+		if tagLen == 0 || audioSize < 0 {
+			return nil, 0, fmt.Errorf("%w: bad tag length %d", QmcKeyErr, tagLen)
+		}
+		tag, err := readAt(r, audioSize, tagLen)
+		if err != nil {
+			return nil, 0, err
+		}
+		rawKey = bytes.SplitN(tag, []byte(","), 2)[0]
+	case "STag":
+		return nil, 0, fmt.Errorf("%w: key is not embedded", QmcKeyErr)
+	default:
+		// 密钥 + 4字节小端长度
+		keyLen := int64(binary.LittleEndian.Uint32(tail[4:]))
+		if keyLen == 0 || keyLen > 0x400 || keyLen > size-4 {
+			return nil, size, nil
+		}
+		audioSize = size - 4 - keyLen
+		var err error
+		rawKey, err = readAt(r, audioSize, keyLen)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	key, err := deriveQmcKey(rawKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	return key, audioSize, nil
+}
+
+func readAt(r io.ReadSeeker, offset, length int64) ([]byte, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// deriveQmcKey 解出文件末尾base64编码的密钥
+func deriveQmcKey(rawKey []byte) ([]byte, error) {
+	rawKeyDec := make([]byte, base64.StdEncoding.DecodedLen(len(rawKey)))
+	n, err := base64.StdEncoding.Decode(rawKeyDec, rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", QmcKeyErr, err)
+	}
+	rawKeyDec = rawKeyDec[:n]
+
+	if bytes.HasPrefix(rawKeyDec, []byte("QQMusic EncV2,Key:")) {
+		return nil, fmt.Errorf("%w: EncV2 key is not supported", QmcKeyErr)
+	}
+	if len(rawKeyDec) < 16 {
+		return nil, fmt.Errorf("%w: key is too short", QmcKeyErr)
+	}
+
+	simpleKey := qmcSimpleMakeKey(106, 8)
+	teaKey := make([]byte, 16)
+	for i := 0; i < 8; i++ {
+		teaKey[i<<1] = simpleKey[i]
+		teaKey[i<<1+1] = rawKeyDec[i]
+	}
+	rs, err := decryptTencentTea(rawKeyDec[8:], teaKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", QmcKeyErr, err)
+	}
+	return append(rawKeyDec[:8], rs...), nil
+}
+
+func qmcSimpleMakeKey(salt byte, length int) []byte {
+	keyBuf := make([]byte, length)
+	for i := 0; i < length; i++ {
+		tmp := math.Tan(float64(salt) + float64(i)*0.1)
+		keyBuf[i] = byte(math.Abs(tmp) * 100.0)
+	}
+	return keyBuf
+}
+
+// decryptTencentTea QQ使用的 TEA-CBC 变种 16轮
+func decryptTencentTea(inBuf []byte, key []byte) ([]byte, error) {
+	const saltLen = 2
+	const zeroLen = 7
+	if len(inBuf)%8 != 0 {
+		return nil, errors.New("tea: input size is not a multiple of the block size")
+	}
+	if len(inBuf) < 16 {
+		return nil, errors.New("tea: input size is too small")
+	}
+
+	k := [4]uint32{
+		binary.BigEndian.Uint32(key[0:]),
+		binary.BigEndian.Uint32(key[4:]),
+		binary.BigEndian.Uint32(key[8:]),
+		binary.BigEndian.Uint32(key[12:]),
+	}
+
+	destBuf := make([]byte, 8)
+	teaDecryptBlock(destBuf, inBuf[:8], k)
+	padLen := int(destBuf[0] & 0x7)
+	outLen := len(inBuf) - 1 - padLen - saltLen - zeroLen
+	if outLen < 0 {
+		return nil, errors.New("tea: bad padding")
+	}
+	out := make([]byte, outLen)
+
+	ivPrev := make([]byte, 8)
+	ivCur := inBuf[:8]
+	inBufPos := 8
+	destIdx := 1 + padLen
+
+	nextBlock := func() error {
+		if inBufPos+8 > len(inBuf) {
+			return errors.New("tea: unexpected end of input")
+		}
+		ivPrev = ivCur
+		ivCur = inBuf[inBufPos : inBufPos+8]
+		for i := 0; i < 8; i++ {
+			destBuf[i] ^= ivCur[i]
+		}
+		teaDecryptBlock(destBuf, destBuf, k)
+		inBufPos += 8
+		destIdx = 0
+		return nil
+	}
+
+	// 跳过salt
+	for i := 0; i < saltLen; {
+		if destIdx < 8 {
+			destIdx++
+			i++
+		} else if err := nextBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	for outPos := 0; outPos < outLen; {
+		if destIdx < 8 {
+			out[outPos] = destBuf[destIdx] ^ ivPrev[destIdx]
+			destIdx++
+			outPos++
+		} else if err := nextBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < zeroLen; {
+		if destIdx < 8 {
+			if destBuf[destIdx] != ivPrev[destIdx] {
+				return nil, errors.New("tea: zero check failed")
+			}
+			destIdx++
+			i++
+		} else if err := nextBlock(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+const (
+	teaDelta = 0x9e3779b9
+	// teaDelta * 16 截断为32位
+	teaSum = 0xe3779b90
+)
+
+func teaDecryptBlock(dst, src []byte, k [4]uint32) {
+	v0 := binary.BigEndian.Uint32(src[0:])
+	v1 := binary.BigEndian.Uint32(src[4:])
+	sum := uint32(teaSum)
+	for i := 0; i < 16; i++ {
+		v1 -= ((v0 << 4) + k[2]) ^ (v0 + sum) ^ ((v0 >> 5) + k[3])
+		v0 -= ((v1 << 4) + k[0]) ^ (v1 + sum) ^ ((v1 >> 5) + k[1])
+		sum -= teaDelta
+	}
+	binary.BigEndian.PutUint32(dst[0:], v0)
+	binary.BigEndian.PutUint32(dst[4:], v1)
+}
+
+var qmcSeedMap = [8][7]byte{
+	{0x4a, 0xd6, 0xca, 0x90, 0x67, 0xf7, 0x52},
+	{0x5e, 0x95, 0x23, 0x9f, 0x13, 0x11, 0x7e},
+	{0x47, 0x74, 0x3d, 0x90, 0xaa, 0x3f, 0x51},
+	{0xc6, 0x09, 0xd5, 0x9f, 0xfa, 0x66, 0xf9},
+	{0xf3, 0xd6, 0xa1, 0x90, 0xa0, 0xf7, 0xf0},
+	{0x1d, 0x95, 0xde, 0x9f, 0x84, 0x11, 0xf4},
+	{0x0e, 0x74, 0xbb, 0x90, 0xbc, 0x3f, 0x92},
+	{0x00, 0x09, 0x5b, 0x9f, 0x62, 0x66, 0xa1},
+}
+
+// qmcStaticMask 固定密钥流 周期为128
+var qmcStaticMask = buildQmcStaticMask()
+
+func buildQmcStaticMask() [128]byte {
+	var mask [128]byte
+	x, y, dx := -1, 8, 1
+	for i := range mask {
+		switch {
+		case x < 0:
+			dx = 1
+			y = (8 - y) % 8
+			mask[i] = 0xc3
+		case x > 6:
+			dx = -1
+			y = 7 - y
+			mask[i] = 0xd8
+		default:
+			mask[i] = qmcSeedMap[y][x]
+		}
+		x += dx
+	}
+	return mask
+}
+
+// qmcStaticCipher 没有密钥的 QMC 文件
+// 密钥流在第 0x8000 个以及之后每 0x8000 个的前一个位置各跳过一个字节
+type qmcStaticCipher struct {
+}
+
+func (c qmcStaticCipher) Decrypt(buf []byte, offset int64) {
+	for i := range buf {
+		buf[i] ^= qmcStaticMask[qmcStaticIndex(offset+int64(i))%128]
+	}
+}
+
+func qmcStaticIndex(offset int64) int64 {
+	if offset < 0x8000 {
+		return offset
+	}
+	q := offset - 0x8000
+	if q < 0x7ffe {
+		return 0x8001 + q
+	}
+	q -= 0x7ffe
+	return 0x10000 + q/0x7fff*0x8000 + q%0x7fff
+}
+
+// qmcMapCipher 密钥长度不超过300时使用
+type qmcMapCipher struct {
+	key []byte
+}
+
+func newQmcMapCipher(key []byte) *qmcMapCipher {
+	return &qmcMapCipher{key: key}
+}
+
+func (c *qmcMapCipher) Decrypt(buf []byte, offset int64) {
+	for i := range buf {
+		buf[i] ^= c.mask(offset + int64(i))
+	}
+}
+
+func (c *qmcMapCipher) mask(offset int64) byte {
+	if offset > 0x7fff {
+		offset %= 0x7fff
+	}
+	idx := (offset*offset + 71214) % int64(len(c.key))
+	value := c.key[idx]
+	rotate := (byte(idx)&0x7 + 4) % 8
+	return value<<rotate | value>>rotate
+}
+
+const (
+	qmcRC4SegmentSize      = 5120
+	qmcRC4FirstSegmentSize = 128
+)
+
+// qmcRC4Cipher 密钥长度超过300时使用 按5120字节分段的rc4
+type qmcRC4Cipher struct {
+	key  []byte
+	box  []byte
+	n    int
+	hash uint32
+}
+
+func newQmcRC4Cipher(key []byte) *qmcRC4Cipher {
+	n := len(key)
+	c := &qmcRC4Cipher{key: key, n: n, box: make([]byte, n)}
+	for i := 0; i < n; i++ {
+		c.box[i] = byte(i)
+	}
+	j := 0
+	for i := 0; i < n; i++ {
+		j = (j + int(c.box[i]) + int(key[i%n])) % n
+		c.box[i], c.box[j] = c.box[j], c.box[i]
+	}
+
+	c.hash = 1
+	for i := 0; i < n; i++ {
+		v := uint32(key[i])
+		if v == 0 {
+			continue
+		}
+		next := c.hash * v
+		if next == 0 || next <= c.hash {
+			break
+		}
+		c.hash = next
+	}
+	return c
+}
+
+func (c *qmcRC4Cipher) Decrypt(buf []byte, offset int64) {
+	for len(buf) > 0 {
+		var size int64
+		if offset < qmcRC4FirstSegmentSize {
+			size = qmcRC4FirstSegmentSize - offset
+		} else {
+			size = qmcRC4SegmentSize - offset%qmcRC4SegmentSize
+		}
+		if size > int64(len(buf)) {
+			size = int64(len(buf))
+		}
+
+		if offset < qmcRC4FirstSegmentSize {
+			c.firstSegment(buf[:size], offset)
+		} else {
+			c.segment(buf[:size], offset)
+		}
+		buf = buf[size:]
+		offset += size
+	}
+}
+
+func (c *qmcRC4Cipher) firstSegment(buf []byte, offset int64) {
+	for i := range buf {
+		buf[i] ^= c.key[c.segmentSkip(offset+int64(i))]
+	}
+}
+
+func (c *qmcRC4Cipher) segment(buf []byte, offset int64) {
+	box := make([]byte, c.n)
+	copy(box, c.box)
+	j, k := 0, 0
+
+	skip := int(offset%qmcRC4SegmentSize) + c.segmentSkip(offset/qmcRC4SegmentSize)
+	for i := -skip; i < len(buf); i++ {
+		j = (j + 1) % c.n
+		k = (int(box[j]) + k) % c.n
+		box[j], box[k] = box[k], box[j]
+		if i >= 0 {
+			buf[i] ^= box[(int(box[j])+int(box[k]))%c.n]
+		}
+	}
+}
+
+func (c *qmcRC4Cipher) segmentSkip(id int64) int {
+	seed := int64(c.key[id%int64(c.n)])
+	if seed == 0 {
+		return 0
+	}
+	idx := int64(float64(c.hash) / float64((id+1)*seed) * 100.0)
+	return int(idx % int64(c.n))
+}
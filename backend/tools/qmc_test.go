@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// qmcSequentialMask 按原始算法逐字节生成的密钥流 用于校验 qmcStaticIndex
+type qmcSequentialMask struct {
+	x, y, dx, index int
+}
+
+func (m *qmcSequentialMask) next() byte {
+	var ret byte
+	m.index++
+	if m.x < 0 {
+		m.dx = 1
+		m.y = (8 - m.y) % 8
+		ret = 0xc3
+	} else if m.x > 6 {
+		m.dx = -1
+		m.y = 7 - m.y
+		ret = 0xd8
+	} else {
+		ret = qmcSeedMap[m.y][m.x]
+	}
+	m.x += m.dx
+	if m.index == 0x8000 || (m.index > 0x8000 && (m.index+1)%0x8000 == 0) {
+		return m.next()
+	}
+	return ret
+}
+
+func TestQmcStaticCipher(t *testing.T) {
+	seq := &qmcSequentialMask{x: -1, y: 8, dx: 1, index: -1}
+	size := 0x8000 * 5
+	want := make([]byte, size)
+	for i := range want {
+		want[i] = seq.next()
+	}
+
+	got := make([]byte, size)
+	qmcStaticCipher{}.Decrypt(got, 0)
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("mask mismatch at offset %#x", i)
+		}
+	}
+}
+
+func TestQmcCipher_Offset(t *testing.T) {
+	key := make([]byte, 512)
+	for i := range key {
+		key[i] = byte(i*31 + 7)
+	}
+
+	ciphers := map[string]streamCipher{
+		"static": qmcStaticCipher{},
+		"map":    newQmcMapCipher(key[:256]),
+		"rc4":    newQmcRC4Cipher(key),
+	}
+	for name, cipher := range ciphers {
+		whole := bytes.Repeat([]byte{0x5a}, 3*qmcRC4SegmentSize+77)
+		cipher.Decrypt(whole, 0)
+
+		chunked := bytes.Repeat([]byte{0x5a}, len(whole))
+		for offset := 0; offset < len(chunked); offset += 1000 {
+			end := offset + 1000
+			if end > len(chunked) {
+				end = len(chunked)
+			}
+			cipher.Decrypt(chunked[offset:end], int64(offset))
+		}
+		if !bytes.Equal(whole, chunked) {
+			t.Fatalf("%s: chunked decrypt mismatch", name)
+		}
+	}
+}
+
+func teaEncryptBlock(dst, src []byte, k [4]uint32) {
+	v0 := binary.BigEndian.Uint32(src[0:])
+	v1 := binary.BigEndian.Uint32(src[4:])
+	var sum uint32
+	for i := 0; i < 16; i++ {
+		sum += teaDelta
+		v0 += ((v1 << 4) + k[0]) ^ (v1 + sum) ^ ((v1 >> 5) + k[1])
+		v1 += ((v0 << 4) + k[2]) ^ (v0 + sum) ^ ((v0 >> 5) + k[3])
+	}
+	binary.BigEndian.PutUint32(dst[0:], v0)
+	binary.BigEndian.PutUint32(dst[4:], v1)
+}
+
+func TestTeaDecryptBlock(t *testing.T) {
+	k := [4]uint32{0x01234567, 0x89abcdef, 0xfedcba98, 0x76543210}
+	plain := []byte("qmc-tea!")
+	encrypted := make([]byte, 8)
+	teaEncryptBlock(encrypted, plain, k)
+
+	decrypted := make([]byte, 8)
+	teaDecryptBlock(decrypted, encrypted, k)
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatalf("expected %q, got %q", plain, decrypted)
+	}
+}
@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ScanOptions 目录扫描参数
+type ScanOptions struct {
+	// 是否扫描子目录
+	Recursive bool `json:"recursive"`
+	// 最大扫描深度 0 不限制 1 表示只扫描一层子目录
+	MaxDepth int `json:"max_depth"`
+	// glob 规则 匹配文件名或相对于扫描目录的路径 如 "*.ncm" "Jay/*/*.ncm"
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// 是否跟随符号链接
+	FollowSymlinks bool `json:"follow_symlinks"`
+	// 是否跳过 "." 开头的隐藏文件和目录
+	SkipHidden bool `json:"skip_hidden"`
+	// 大于0时分批通过事件返回结果
+	BatchSize int `json:"batch_size"`
+	// 是否读取NCM文件头中的歌曲信息和封面
+	Inspect bool `json:"inspect"`
+}
+
+// ScanMusicFiles 扫描目录下已注册格式的加密音乐 每找到一个文件调用一次fn
+func ScanMusicFiles(ctx context.Context, root string, options ScanOptions, fn func(path string, info fs.FileInfo) error) error {
+	return scanFiles(ctx, root, options, IsEncryptedMusic, fn)
+}
+
+// scanFiles 扫描目录下文件名满足 match 的文件
+func scanFiles(ctx context.Context, root string, options ScanOptions, match func(name string) bool, fn func(path string, info fs.FileInfo) error) error {
+	if _, err := os.ReadDir(root); err != nil {
+		return err
+	}
+	s := &scanner{
+		ctx:     ctx,
+		options: options,
+		match:   match,
+		fn:      fn,
+		visited: make(map[string]struct{}),
+	}
+	return s.walk(root, "", 0)
+}
+
+type scanner struct {
+	ctx     context.Context
+	options ScanOptions
+	match   func(name string) bool
+	fn      func(path string, info fs.FileInfo) error
+
+	// 已扫描的目录 跟随符号链接时防止循环
+	visited map[string]struct{}
+}
+
+func (s *scanner) walk(dir, rel string, depth int) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	default:
+	}
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.visited[realDir]; ok {
+		return nil
+	}
+	s.visited[realDir] = struct{}{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if s.options.SkipHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		relPath := filepath.ToSlash(filepath.Join(rel, name))
+
+		info, err := entry.Info()
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if !s.options.FollowSymlinks {
+				continue
+			}
+			if info, err = os.Stat(path); err != nil {
+				logger.Error(err.Error())
+				continue
+			}
+		}
+
+		if info.IsDir() {
+			if !s.options.Recursive || matchAny(s.options.Exclude, name, relPath) {
+				continue
+			}
+			if s.options.MaxDepth > 0 && depth >= s.options.MaxDepth {
+				continue
+			}
+			if err = s.walk(path, relPath, depth+1); err != nil {
+				if s.ctx.Err() != nil {
+					return err
+				}
+				logger.Error(fmt.Sprintf("scan %s failed: %v", path, err))
+			}
+			continue
+		}
+
+		if !s.match(name) {
+			continue
+		}
+		if len(s.options.Include) > 0 && !matchAny(s.options.Include, name, relPath) {
+			continue
+		}
+		if matchAny(s.options.Exclude, name, relPath) {
+			continue
+		}
+		if err = s.fn(path, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchAny 文件名或相对路径匹配任意一个glob规则
+// relPath 用 "/" 分隔 需要用 path.Match Windows 上 filepath.Match 的分隔符是 "\\"
+func matchAny(patterns []string, name, relPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func makeScanTree(t *testing.T) string {
+	root := t.TempDir()
+	files := []string{
+		"a.ncm",
+		"readme.txt",
+		"Artist/Album/01.ncm",
+		"Artist/Album/cover.jpg",
+		"Artist/Album/Disc 2/02.qmcflac",
+		"Artist/Live/03.ncm",
+		".hidden/04.ncm",
+	}
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func scanRel(t *testing.T, root string, options ScanOptions) []string {
+	res := make([]string, 0)
+	err := ScanMusicFiles(context.Background(), root, options, func(path string, info fs.FileInfo) error {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		res = append(res, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func assertScan(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestScanMusicFiles(t *testing.T) {
+	root := makeScanTree(t)
+
+	assertScan(t, scanRel(t, root, ScanOptions{}), "a.ncm")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true}),
+		"Artist/Album/01.ncm", "Artist/Album/Disc 2/02.qmcflac", "Artist/Live/03.ncm", "a.ncm")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true}),
+		".hidden/04.ncm", "Artist/Album/01.ncm", "Artist/Album/Disc 2/02.qmcflac", "Artist/Live/03.ncm", "a.ncm")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, MaxDepth: 2, SkipHidden: true}),
+		"Artist/Album/01.ncm", "Artist/Live/03.ncm", "a.ncm")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true, Include: []string{"*.ncm"}, Exclude: []string{"Live"}}),
+		"Artist/Album/01.ncm", "a.ncm")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true, Include: []string{"Artist/*/*"}}),
+		"Artist/Album/01.ncm", "Artist/Live/03.ncm")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true, Include: []string{"Artist/*/Disc 2/*"}}),
+		"Artist/Album/Disc 2/02.qmcflac")
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true, Exclude: []string{"Artist/Album/*", "Artist/*/Disc 2/*"}}),
+		"Artist/Live/03.ncm", "a.ncm")
+}
+
+func TestScanMusicFiles_Symlink(t *testing.T) {
+	root := makeScanTree(t)
+	// 指向上级目录的链接 跟随时不能死循环
+	if err := os.Symlink(root, filepath.Join(root, "Artist", "loop")); err != nil {
+		t.Skip(err)
+	}
+
+	assertScan(t, scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true}),
+		"Artist/Album/01.ncm", "Artist/Album/Disc 2/02.qmcflac", "Artist/Live/03.ncm", "a.ncm")
+
+	got := scanRel(t, root, ScanOptions{Recursive: true, SkipHidden: true, FollowSymlinks: true})
+	assertScan(t, got, "Artist/Album/01.ncm", "Artist/Album/Disc 2/02.qmcflac", "Artist/Live/03.ncm", "a.ncm")
+}
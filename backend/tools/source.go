@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/wanyuqin/tool-collection/configs"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	ArchiveNotFoundErr     = errors.New("archived source not found")
+	ArchiveRestoreExistErr = errors.New("restore target already exists")
+	OutputUnverifiedErr    = errors.New("output is empty or can not be tagged")
+)
+
+// DefaultArchiveName 源文件归档目录 放在 ~/.tools_collection 下
+var DefaultArchiveName = "archive"
+
+// archiveInfoName 归档目录中记录原始路径的文件
+const archiveInfoName = "source.json"
+
+// ArchiveEntry 一个归档的源文件
+type ArchiveEntry struct {
+	ID string `json:"id"`
+	// 源文件原来的路径 恢复时移回该位置
+	Source string `json:"source"`
+	// 源文件现在的路径
+	Path   string `json:"path"`
+	Output string `json:"output"`
+	Time   int64  `json:"time"` // 归档时间 秒
+}
+
+// SourceArchive 转换成功后移走的源文件 每个文件一个目录 可以恢复到原来的位置
+type SourceArchive struct {
+	dir string
+}
+
+// NewSourceArchive dir 为空时使用 ~/.tools_collection/archive
+func NewSourceArchive(dir string) *SourceArchive {
+	if dir == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(homeDir, ".tools_collection", DefaultArchiveName)
+		}
+	}
+	return &SourceArchive{dir: dir}
+}
+
+// Archive 把源文件移到归档目录
+func (a *SourceArchive) Archive(source, output string) (ArchiveEntry, error) {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	entry := ArchiveEntry{
+		ID:     uuid.NewString(),
+		Source: source,
+		Output: output,
+		Time:   time.Now().Unix(),
+	}
+	dir := filepath.Join(a.dir, entry.ID)
+	entry.Path = filepath.Join(dir, filepath.Base(source))
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return entry, err
+	}
+
+	info, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	if err = os.WriteFile(filepath.Join(dir, archiveInfoName), info, 0666); err != nil {
+		os.RemoveAll(dir)
+		return entry, err
+	}
+	if err = moveFile(source, entry.Path); err != nil {
+		os.RemoveAll(dir)
+		return entry, err
+	}
+	return entry, nil
+}
+
+// List 所有归档的源文件 按归档时间倒序
+func (a *SourceArchive) List() ([]ArchiveEntry, error) {
+	dirs, err := os.ReadDir(a.dir)
+	if os.IsNotExist(err) {
+		return []ArchiveEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ArchiveEntry, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entry, err := a.entry(dir.Name())
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time > entries[j].Time
+	})
+	return entries, nil
+}
+
+// Restore 把归档的源文件移回原来的位置 原位置已有文件时返回 ArchiveRestoreExistErr
+func (a *SourceArchive) Restore(id string) (string, error) {
+	entry, err := a.entry(id)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(entry.Source); err == nil {
+		return "", ArchiveRestoreExistErr
+	}
+	if err = os.MkdirAll(filepath.Dir(entry.Source), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err = moveFile(entry.Path, entry.Source); err != nil {
+		return "", err
+	}
+	return entry.Source, os.RemoveAll(filepath.Join(a.dir, entry.ID))
+}
+
+func (a *SourceArchive) entry(id string) (ArchiveEntry, error) {
+	var entry ArchiveEntry
+	// id 只能是归档目录下的一级目录名
+	if id == "" || filepath.Base(id) != id || id == "." || id == ".." {
+		return entry, ArchiveNotFoundErr
+	}
+	data, err := os.ReadFile(filepath.Join(a.dir, id, archiveInfoName))
+	if os.IsNotExist(err) {
+		return entry, ArchiveNotFoundErr
+	}
+	if err != nil {
+		return entry, err
+	}
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return entry, err
+	}
+	entry.ID = id
+	entry.Path = filepath.Join(a.dir, id, filepath.Base(entry.Source))
+	return entry, nil
+}
+
+// handleSource 按策略处理转换成功的源文件 返回实际执行的策略
+func handleSource(source, output, policy string, archive *SourceArchive) (string, string, error) {
+	switch policy {
+	case configs.SourceDelete:
+		if err := os.Remove(source); err != nil {
+			return configs.SourceKeep, "", err
+		}
+		return configs.SourceDelete, "", nil
+	case configs.SourceArchive:
+		if archive == nil {
+			archive = NewSourceArchive("")
+		}
+		entry, err := archive.Archive(source, output)
+		if err != nil {
+			return configs.SourceKeep, "", err
+		}
+		return configs.SourceArchive, entry.ID, nil
+	default:
+		return configs.SourceKeep, "", nil
+	}
+}
+
+// verifyOutput 输出文件非空 标签写入成功 并且能识别出和 format 一致的容器格式
+// 写入标签后 mp3 总是以ID3开头 需要跳过标签识别音频数据
+func verifyOutput(path, format string, tagErr error) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	header := make([]byte, audioFormatHeaderSize)
+	n, _ := io.ReadFull(fp, header)
+	if n == 0 {
+		return fmt.Errorf("%w: empty output", OutputUnverifiedErr)
+	}
+	if tagErr != nil {
+		return fmt.Errorf("%w: %v", OutputUnverifiedErr, tagErr)
+	}
+	if size, ok := id3TagSize(header[:n]); ok {
+		if _, err = fp.Seek(size, io.SeekStart); err != nil {
+			return err
+		}
+		n, _ = io.ReadFull(fp, header)
+	}
+	detected := SniffAudioFormat(header[:n])
+	if detected == "" {
+		return fmt.Errorf("%w: unknown container", OutputUnverifiedErr)
+	}
+	if detected != format {
+		return fmt.Errorf("%w: expected %s, detected %s", OutputUnverifiedErr, format, detected)
+	}
+	return nil
+}
+
+// id3TagSize ID3v2 标签头中的标签大小 包含10字节的头和可能存在的尾
+func id3TagSize(header []byte) (int64, bool) {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0, false
+	}
+	var size int64
+	for _, b := range header[6:10] {
+		if b&0x80 != 0 {
+			return 0, false
+		}
+		size = size<<7 | int64(b)
+	}
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, true
+}
+
+// moveFile 移动文件 不在同一个文件系统时复制后删除
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
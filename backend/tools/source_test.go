@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestNcm(t *testing.T, path string, audio []byte, format string) []byte {
+	data := encodeTestNcm(t, audio, &MetaInfo{MusicName: "晴天", Format: format}, nil)
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestProcessMusicFileSourcePolicy(t *testing.T) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	archive := NewSourceArchive(filepath.Join(t.TempDir(), DefaultArchiveName))
+
+	tests := []struct {
+		name   string
+		format string
+		audio  []byte
+		policy string
+		want   string
+	}{
+		{"keep.ncm", "mp3", testAudio(100), configs.SourceKeep, configs.SourceKeep},
+		{"delete.ncm", "mp3", append([]byte{0xff, 0xfb, 0x90, 0x64}, testAudio(100)...), configs.SourceDelete, configs.SourceDelete},
+		{"archive.ncm", "ogg", append([]byte("OggS"), testAudio(100)...), configs.SourceArchive, configs.SourceArchive},
+		// 无法识别输出格式时保留源文件
+		{"unknown.ncm", "ogg", testAudio(100), configs.SourceDelete, configs.SourceKeep},
+		// 元数据格式为mp3 但解密结果不是音频 写入标签也不能通过校验
+		{"garbage.ncm", "mp3", testAudio(100), configs.SourceDelete, configs.SourceKeep},
+		// 写入标签失败时保留源文件
+		{"badtag.ncm", "flac", testAudio(100), configs.SourceArchive, configs.SourceKeep},
+	}
+	for _, tt := range tests {
+		input := filepath.Join(dir, tt.name)
+		writeTestNcm(t, input, tt.audio, tt.format)
+
+		options := DefaultTransformOptions()
+		options.SourcePolicy = tt.policy
+		options.Archive = archive
+		result := ProcessMusicFile(context.Background(), input, options)
+		if !result.Success() {
+			t.Fatalf("%s: %v", tt.name, result.Err)
+		}
+		if result.SourcePolicy != tt.want {
+			t.Fatalf("%s: expected policy %s, got %+v", tt.name, tt.want, result)
+		}
+		if tt.want != tt.policy && len(result.Warnings) == 0 {
+			t.Fatalf("%s: expected warning, got %+v", tt.name, result)
+		}
+		_, err := os.Stat(input)
+		if exist := err == nil; exist != (tt.want == configs.SourceKeep) {
+			t.Fatalf("%s: unexpected source state %v", tt.name, err)
+		}
+		if (result.ArchiveID != "") != (tt.want == configs.SourceArchive) {
+			t.Fatalf("%s: unexpected archive id %q", tt.name, result.ArchiveID)
+		}
+	}
+}
+
+func TestSourceArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := NewSourceArchive(filepath.Join(t.TempDir(), DefaultArchiveName))
+	input := filepath.Join(dir, "a.ncm")
+	data := writeTestNcm(t, input, testAudio(100), "mp3")
+
+	entry, err := archive.Archive(input, filepath.Join(dir, "a.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(input); !os.IsNotExist(err) {
+		t.Fatalf("expected source moved, got %v", err)
+	}
+
+	entries, err := archive.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != entry.ID || entries[0].Source != input {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	// 原位置已有文件时不覆盖
+	if err = os.WriteFile(input, []byte("new"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = archive.Restore(entry.ID); !errors.Is(err, ArchiveRestoreExistErr) {
+		t.Fatalf("expected ArchiveRestoreExistErr, got %v", err)
+	}
+	os.Remove(input)
+
+	restored, err := archive.Restore(entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(restored); restored != input || !bytes.Equal(got, data) {
+		t.Fatalf("unexpected restored file %s", restored)
+	}
+	if entries, _ = archive.List(); len(entries) != 0 {
+		t.Fatalf("expected empty archive, got %+v", entries)
+	}
+	for _, id := range []string{entry.ID, "", "..", "../x"} {
+		if _, err = archive.Restore(id); !errors.Is(err, ArchiveNotFoundErr) {
+			t.Fatalf("restore %q: expected ArchiveNotFoundErr, got %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package tools
+
+import (
+	"fmt"
+	"github.com/bogem/id3v2"
+	"github.com/go-flac/flacpicture"
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 可以写入标签的元数据字段
+const (
+	TagTitle    = "title"
+	TagAlbum    = "album"
+	TagArtist   = "artist"
+	TagLength   = "length"
+	TagBitRate  = "bitrate"
+	TagSubtitle = "subtitle"
+	TagMusicID  = "music_id"
+	TagAlbumID  = "album_id"
+	TagMvID     = "mv_id"
+	TagLyrics   = "lyrics"
+)
+
+// DefaultId3Mapping 元数据字段到 ID3v2 帧的默认映射
+// 值可以是文本帧ID 如 "TIT2", 也可以是 "TXXX:描述" "COMM:描述" 或 "USLT:描述"
+// 歌词有时间标签时同时写入 SYLT
+var DefaultId3Mapping = map[string]string{
+	TagTitle:    "TIT2",
+	TagAlbum:    "TALB",
+	TagArtist:   "TPE1",
+	TagLength:   "TLEN",
+	TagBitRate:  "TXXX:NETEASE_BITRATE",
+	TagSubtitle: "TIT3",
+	TagMusicID:  "TXXX:NETEASE_MUSIC_ID",
+	TagAlbumID:  "TXXX:NETEASE_ALBUM_ID",
+	TagMvID:     "TXXX:NETEASE_MV_ID",
+	TagLyrics:   "USLT",
+}
+
+// DefaultVorbisMapping 元数据字段到 Vorbis comment 的默认映射
+var DefaultVorbisMapping = map[string]string{
+	TagTitle:    flacvorbis.FIELD_TITLE,
+	TagAlbum:    flacvorbis.FIELD_ALBUM,
+	TagArtist:   flacvorbis.FIELD_ARTIST,
+	TagLength:   "LENGTH",
+	TagBitRate:  "NETEASE_BITRATE",
+	TagSubtitle: "SUBTITLE",
+	TagMusicID:  "NETEASE_MUSIC_ID",
+	TagAlbumID:  "NETEASE_ALBUM_ID",
+	TagMvID:     "NETEASE_MV_ID",
+	TagLyrics:   "LYRICS",
+}
+
+// TagOptions 标签写入参数
+type TagOptions struct {
+	// 是否覆盖文件中已有的标签
+	Overwrite bool
+	// 元数据字段到帧或字段名的映射 值为空时不写入
+	Id3    map[string]string
+	Vorbis map[string]string
+}
+
+// DefaultTagOptions 使用默认映射 保留已有标签
+func DefaultTagOptions() *TagOptions {
+	return NewTagOptions(configs.TagConfig{})
+}
+
+// NewTagOptions 配置中的映射覆盖默认映射
+func NewTagOptions(cfg configs.TagConfig) *TagOptions {
+	options := &TagOptions{
+		Overwrite: cfg.Overwrite,
+		Id3:       make(map[string]string, len(DefaultId3Mapping)),
+		Vorbis:    make(map[string]string, len(DefaultVorbisMapping)),
+	}
+	for k, v := range DefaultId3Mapping {
+		options.Id3[k] = v
+	}
+	for k, v := range cfg.Id3 {
+		options.Id3[k] = v
+	}
+	for k, v := range DefaultVorbisMapping {
+		options.Vorbis[k] = v
+	}
+	for k, v := range cfg.Vorbis {
+		options.Vorbis[k] = v
+	}
+	return options
+}
+
+// tagValues 元数据和歌词对应的值 没有值的字段不返回
+func tagValues(meta *MetaInfo, lyrics *Lyrics) map[string][]string {
+	values := make(map[string][]string)
+	add := func(key string, value ...string) {
+		for _, v := range value {
+			if v = strings.TrimSpace(v); v != "" {
+				values[key] = append(values[key], v)
+			}
+		}
+	}
+	addInt := func(key string, value int) {
+		if value > 0 {
+			add(key, strconv.Itoa(value))
+		}
+	}
+
+	add(TagTitle, meta.MusicName)
+	add(TagAlbum, meta.Album)
+	add(TagArtist, meta.ArtistNames()...)
+	// TLEN 单位为毫秒 与NCM中的 duration 一致
+	addInt(TagLength, meta.Duration)
+	addInt(TagBitRate, meta.BitRate)
+	addInt(TagMusicID, meta.MusicID)
+	addInt(TagAlbumID, meta.AlbumID)
+	addInt(TagMvID, meta.MvID)
+
+	subtitles := append(append([]string{}, meta.Alias...), meta.TransNames...)
+	if s := strings.Join(subtitles, "; "); s != "" {
+		add(TagSubtitle, s)
+	}
+	if lyrics != nil {
+		add(TagLyrics, lyrics.Text)
+	}
+	return values
+}
+
+// sortedKeys 按字段名排序 保证每次写入的顺序一致
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// addMP3Tag imgData 和 lyrics 为空时不写入 文件无法解析或写入失败时返回错误
+func addMP3Tag(fileName string, imgData []byte, meta *MetaInfo, lyrics *Lyrics, options *TagOptions) error {
+	if options == nil {
+		options = DefaultTagOptions()
+	}
+	tag, err := id3v2.Open(fileName, id3v2.Options{Parse: true})
+	if err != nil {
+		return err
+	}
+	defer tag.Close()
+
+	pictureID := tag.CommonID("Attached picture")
+	hasPicture := len(tag.GetFrames(pictureID)) > 0
+	if hasPicture && options.Overwrite {
+		tag.DeleteFrames(pictureID)
+		hasPicture = false
+	}
+	if hasPicture {
+		logger.Debug("Keeping existing cover")
+	} else if imgData != nil {
+		tag.AddAttachedPicture(newId3Picture(imgData))
+	}
+
+	values := tagValues(meta, lyrics)
+	for _, key := range sortedKeys(options.Id3) {
+		target := options.Id3[key]
+		if target == "" || len(values[key]) == 0 {
+			continue
+		}
+		logger.Debug(fmt.Sprintf("Adding %s to %s", key, target))
+		setId3Frame(tag, target, values[key], options.Overwrite)
+	}
+	if options.Id3[TagLyrics] != "" && lyrics != nil && len(lyrics.Lines) > 0 {
+		if options.Overwrite || len(tag.GetFrames("SYLT")) == 0 {
+			tag.DeleteFrames("SYLT")
+			tag.AddFrame("SYLT", syltFrame{Encoding: id3Encoding(tag.Version()), Language: "eng", Lines: lyrics.Lines})
+		}
+	}
+	return tag.Save()
+}
+
+// id3Encoding ID3v2.4 使用UTF-8 ID3v2.3 不支持UTF-8 使用带BOM的UTF-16
+func id3Encoding(version byte) id3v2.Encoding {
+	if version >= 4 {
+		return id3v2.EncodingUTF8
+	}
+	return id3v2.EncodingUTF16
+}
+
+// id3Separator 多个值的分隔符 ID3v2.4 用 "\x00" ID3v2.3 用 "/"
+func id3Separator(version byte) string {
+	if version >= 4 {
+		return "\x00"
+	}
+	return "/"
+}
+
+// setId3Frame target 为文本帧ID 或 "TXXX:描述" "COMM:描述"
+// 编码和多个值的分隔符按标签版本选择
+func setId3Frame(tag *id3v2.Tag, target string, values []string, overwrite bool) {
+	id, description := target, ""
+	if i := strings.IndexByte(target, ':'); i >= 0 {
+		id, description = target[:i], target[i+1:]
+	}
+	encoding := id3Encoding(tag.Version())
+	value := strings.Join(values, id3Separator(tag.Version()))
+
+	switch id {
+	case "TXXX":
+		if !overwrite && findUserDefinedText(tag, description) != "" {
+			return
+		}
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    encoding,
+			Description: description,
+			Value:       value,
+		})
+	case "USLT":
+		if !overwrite && findLyrics(tag, description) != "" {
+			return
+		}
+		tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+			Encoding:          encoding,
+			Language:          "eng",
+			ContentDescriptor: description,
+			Lyrics:            value,
+		})
+	case "COMM":
+		if !overwrite && findComment(tag, description) != "" {
+			return
+		}
+		tag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding:    encoding,
+			Language:    "eng",
+			Description: description,
+			Text:        value,
+		})
+	default:
+		if len(id) != 4 || id[0] != 'T' {
+			logger.Error(fmt.Sprintf("unsupported id3 frame %s", target))
+			return
+		}
+		if !overwrite && tag.GetTextFrame(id).Text != "" {
+			return
+		}
+		tag.AddTextFrame(id, encoding, value)
+	}
+}
+
+func findUserDefinedText(tag *id3v2.Tag, description string) string {
+	for _, f := range tag.GetFrames(tag.CommonID("User defined text information frame")) {
+		if udtf, ok := f.(id3v2.UserDefinedTextFrame); ok && udtf.Description == description {
+			return udtf.Value
+		}
+	}
+	return ""
+}
+
+func findLyrics(tag *id3v2.Tag, description string) string {
+	for _, f := range tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription")) {
+		if uslf, ok := f.(id3v2.UnsynchronisedLyricsFrame); ok && uslf.ContentDescriptor == description {
+			return uslf.Lyrics
+		}
+	}
+	return ""
+}
+
+func findComment(tag *id3v2.Tag, description string) string {
+	for _, f := range tag.GetFrames(tag.CommonID("Comments")) {
+		if cf, ok := f.(id3v2.CommentFrame); ok && cf.Description == description {
+			return cf.Text
+		}
+	}
+	return ""
+}
+
+func addFLACTag(fileName string, imgData []byte, meta *MetaInfo, lyrics *Lyrics, options *TagOptions) error {
+	if options == nil {
+		options = DefaultTagOptions()
+	}
+	f, err := flac.ParseFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	hasPicture := false
+	blocks := f.Meta[:0]
+	for _, m := range f.Meta {
+		if m.Type == flac.Picture {
+			if options.Overwrite {
+				continue
+			}
+			hasPicture = true
+		}
+		blocks = append(blocks, m)
+	}
+	f.Meta = blocks
+
+	if hasPicture {
+		logger.Debug("Keeping existing cover")
+	} else if imgData != nil {
+		if picturemeta, err := newFLACPicture(imgData); err == nil {
+			f.Meta = append(f.Meta, picturemeta)
+		}
+	}
+
+	var cmtmeta *flac.MetaDataBlock
+	for _, m := range f.Meta {
+		if m.Type == flac.VorbisComment {
+			cmtmeta = m
+			break
+		}
+	}
+	var cmts *flacvorbis.MetaDataBlockVorbisComment
+	if cmtmeta != nil {
+		cmts, err = flacvorbis.ParseFromMetaDataBlock(*cmtmeta)
+		if err != nil {
+			return err
+		}
+	} else {
+		cmts = flacvorbis.New()
+	}
+
+	values := tagValues(meta, lyrics)
+	for _, key := range sortedKeys(options.Vorbis) {
+		field := options.Vorbis[key]
+		if field == "" || len(values[key]) == 0 {
+			continue
+		}
+		logger.Debug(fmt.Sprintf("Adding %s to %s", key, field))
+		if err = setVorbisComment(cmts, field, values[key], options.Overwrite); err != nil {
+			return fmt.Errorf("set vorbis comment %s failed: %w", field, err)
+		}
+	}
+
+	res := cmts.Marshal()
+	if cmtmeta != nil {
+		*cmtmeta = res
+	} else {
+		f.Meta = append(f.Meta, &res)
+	}
+	return f.Save(fileName)
+}
+
+// setVorbisComment 多个值写入多条同名字段
+func setVorbisComment(cmts *flacvorbis.MetaDataBlockVorbisComment, field string, values []string, overwrite bool) error {
+	existing, err := cmts.Get(field)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		if !overwrite {
+			return nil
+		}
+		comments := cmts.Comments[:0]
+		for _, cmt := range cmts.Comments {
+			if !strings.EqualFold(strings.SplitN(cmt, "=", 2)[0], field) {
+				comments = append(comments, cmt)
+			}
+		}
+		cmts.Comments = comments
+	}
+	for _, value := range values {
+		if err = cmts.Add(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageMIME 封面只支持 jpeg 和 png
+func imageMIME(data []byte) string {
+	if containPNGHeader(data) {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+func newId3Picture(imgData []byte) id3v2.PictureFrame {
+	return id3v2.PictureFrame{
+		Encoding:    id3v2.EncodingISO,
+		MimeType:    imageMIME(imgData),
+		PictureType: id3v2.PTFrontCover,
+		Description: "Front cover",
+		Picture:     imgData,
+	}
+}
+
+func newFLACPicture(imgData []byte) (*flac.MetaDataBlock, error) {
+	picture, err := flacpicture.NewFromImageData(flacpicture.PictureTypeFrontCover, "Front cover", imgData, imageMIME(imgData))
+	if err != nil {
+		return nil, err
+	}
+	picturemeta := picture.Marshal()
+	return &picturemeta, nil
+}
+
+func containPNGHeader(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	return string(data[:8]) == string([]byte{137, 80, 78, 71, 13, 10, 26, 10})
+}
@@ -0,0 +1,636 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bogem/id3v2"
+	"github.com/go-flac/flacpicture"
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	TagFieldUnsupportedErr = errors.New("unsupported tag field")
+	TagEditUnsupportedErr  = errors.New("unsupported tag edit")
+	TagEditInvalidErr      = errors.New("invalid tag edit")
+	TagCoverInvalidErr     = errors.New("cover must be a jpeg or png image")
+	// 读取之后文件被其他程序修改过
+	TagFileChangedErr = errors.New("file changed since tags were read")
+)
+
+// 编辑器额外支持的字段
+const (
+	TagAlbumArtist = "album_artist"
+	TagTrack       = "track"
+	TagDisc        = "disc"
+	TagYear        = "year"
+	TagGenre       = "genre"
+	TagComment     = "comment"
+)
+
+// 批量编辑操作
+const (
+	// 设置字段的值 值为空时删除字段
+	TagEditSet = "set"
+	// 查找替换字段中的文本
+	TagEditReplace = "replace"
+	// 按文件顺序重新编号音轨
+	TagEditRenumber = "renumber"
+	// 替换封面
+	TagEditCover = "cover"
+	// 删除封面
+	TagEditRemoveCover = "remove_cover"
+)
+
+// tagField MP3和FLAC共用的字段 Id3 为空时使用标签版本对应的年份帧
+type tagField struct {
+	Name     string
+	Id3      string
+	Vorbis   string
+	Multiple bool
+}
+
+var tagEditorFields = []tagField{
+	{TagTitle, "TIT2", flacvorbis.FIELD_TITLE, false},
+	{TagSubtitle, "TIT3", "SUBTITLE", false},
+	{TagArtist, "TPE1", flacvorbis.FIELD_ARTIST, true},
+	{TagAlbumArtist, "TPE2", "ALBUMARTIST", true},
+	{TagAlbum, "TALB", flacvorbis.FIELD_ALBUM, false},
+	{TagTrack, "TRCK", flacvorbis.FIELD_TRACKNUMBER, false},
+	{TagDisc, "TPOS", "DISCNUMBER", false},
+	{TagYear, "", flacvorbis.FIELD_DATE, false},
+	{TagGenre, "TCON", flacvorbis.FIELD_GENRE, true},
+	{TagComment, "COMM", "COMMENT", false},
+	{TagLyrics, "USLT", "LYRICS", false},
+}
+
+func findTagField(name string) (tagField, bool) {
+	for _, field := range tagEditorFields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return tagField{}, false
+}
+
+func (f tagField) id3Target(tag *id3v2.Tag) string {
+	if f.Id3 == "" {
+		// v2.3 为 TYER v2.4 为 TDRC
+		return tag.CommonID("Year")
+	}
+	return f.Id3
+}
+
+// TagCover 封面信息 Thumbnail 为缩略图 data URL
+type TagCover struct {
+	MIME      string `json:"mime"`
+	Size      int    `json:"size"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+// TagFile 一个文件的标签 MP3和FLAC使用相同的字段名
+type TagFile struct {
+	Path    string `json:"path"`
+	Format  string `json:"format"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"` // 毫秒时间戳 写入前检查文件是否被修改 纳秒在前端会丢失精度
+	// 可以编辑的字段 写入时不存在的字段保持不变 空列表删除字段
+	Fields map[string][]string `json:"fields"`
+	// 编辑器不支持的其他标签 只读 如 "TXXX:NETEASE_MUSIC_ID" 或 "NETEASE_MUSIC_ID"
+	Extra map[string][]string `json:"extra"`
+	Cover *TagCover           `json:"cover"`
+	// 写入时使用的新封面图片
+	CoverPath   string `json:"cover_path"`
+	RemoveCover bool   `json:"remove_cover"`
+	Error       string `json:"error"`
+}
+
+func (f TagFile) clone() TagFile {
+	fields := make(map[string][]string, len(f.Fields))
+	for k, v := range f.Fields {
+		fields[k] = append([]string{}, v...)
+	}
+	f.Fields = fields
+	return f
+}
+
+// TagEdit 一个批量编辑操作 按顺序应用到所有文件
+type TagEdit struct {
+	Op    string `json:"op"`
+	Field string `json:"field"`
+	// set 的值
+	Values []string `json:"values"`
+	// replace 查找的文本 Regexp 为true时是正则表达式 替换文本可以使用 $1
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+	Regexp  bool   `json:"regexp"`
+	// renumber 的起始编号 默认为1 WithTotal 为true时写入 "3/12"
+	Start     int  `json:"start"`
+	WithTotal bool `json:"with_total"`
+	// cover 的图片路径
+	Path string `json:"path"`
+}
+
+// ReadTagFiles 读取多个文件的标签 失败的文件设置 Error
+func ReadTagFiles(paths []string) []TagFile {
+	files := make([]TagFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := ReadTagFile(path)
+		if err != nil {
+			file = &TagFile{Path: path, Error: err.Error()}
+		}
+		files = append(files, *file)
+	}
+	return files
+}
+
+// ReadTagFile 读取mp3的ID3v2标签或flac的Vorbis comment和封面
+func ReadTagFile(path string) (*TagFile, error) {
+	return readTagFile(path, true)
+}
+
+func readTagFile(path string, withCover bool) (*TagFile, error) {
+	if !IsTaggableAudio(path) {
+		return nil, UnsupportedAudioErr
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &TagFile{
+		Path:    path,
+		Format:  strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")),
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixMilli(),
+		Fields:  make(map[string][]string, len(tagEditorFields)),
+		Extra:   make(map[string][]string),
+	}
+	var cover []byte
+	switch file.Format {
+	case "mp3":
+		cover, err = readMP3TagFile(file)
+	default:
+		cover, err = readFLACTagFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if withCover && len(cover) > 0 {
+		file.Cover = newTagCover(cover)
+	}
+	return file, nil
+}
+
+func newTagCover(data []byte) *TagCover {
+	return &TagCover{
+		MIME:      imageMIME(data),
+		Size:      len(data),
+		Thumbnail: coverThumbnail(data, coverThumbnailSize),
+	}
+}
+
+func readMP3TagFile(file *TagFile) ([]byte, error) {
+	tag, err := id3v2.Open(file.Path, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+
+	editable := make(map[string]struct{}, len(tagEditorFields))
+	for _, field := range tagEditorFields {
+		target := field.id3Target(tag)
+		editable[target] = struct{}{}
+		file.Fields[field.Name] = id3FieldValues(tag, target, field.Multiple)
+	}
+
+	for id, frames := range tag.AllFrames() {
+		for _, frame := range frames {
+			switch f := frame.(type) {
+			case id3v2.UserDefinedTextFrame:
+				file.Extra[id+":"+f.Description] = append(file.Extra[id+":"+f.Description], f.Value)
+			case id3v2.CommentFrame:
+				// 没有描述的注释是 comment 字段
+				if f.Description != "" {
+					file.Extra[id+":"+f.Description] = append(file.Extra[id+":"+f.Description], f.Text)
+				}
+			case id3v2.TextFrame:
+				if _, ok := editable[id]; !ok {
+					file.Extra[id] = append(file.Extra[id], f.Text)
+				}
+			}
+		}
+	}
+
+	var cover []byte
+	for _, frame := range tag.GetFrames(tag.CommonID("Attached picture")) {
+		if pic, ok := frame.(id3v2.PictureFrame); ok && (cover == nil || pic.PictureType == id3v2.PTFrontCover) {
+			cover = pic.Picture
+		}
+	}
+	return cover, nil
+}
+
+// id3FieldValues 读取文本帧 "COMM:描述" 或 "USLT:描述"
+func id3FieldValues(tag *id3v2.Tag, target string, multiple bool) []string {
+	id, description, _ := strings.Cut(target, ":")
+	var text string
+	switch id {
+	case "COMM":
+		text = findComment(tag, description)
+	case "USLT":
+		text = findLyrics(tag, description)
+	default:
+		text = tag.GetTextFrame(id).Text
+	}
+	if multiple {
+		return cleanTagValues(splitId3Values(text, tag.Version()))
+	}
+	return cleanTagValues([]string{strings.TrimRight(text, "\x00")})
+}
+
+func readFLACTagFile(file *TagFile) ([]byte, error) {
+	fp, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	// 只读取元数据块
+	f, err := flac.ParseMetadata(fp)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range tagEditorFields {
+		file.Fields[field.Name] = make([]string, 0)
+	}
+
+	var cover []byte
+	for _, m := range f.Meta {
+		switch m.Type {
+		case flac.VorbisComment:
+			cmts, err := flacvorbis.ParseFromMetaDataBlock(*m)
+			if err != nil {
+				return nil, err
+			}
+			for _, cmt := range cmts.Comments {
+				key, value, ok := strings.Cut(cmt, "=")
+				if !ok {
+					continue
+				}
+				key = strings.ToUpper(key)
+				if name, ok := vorbisFieldName(key); ok {
+					file.Fields[name] = cleanTagValues(append(file.Fields[name], value))
+				} else {
+					file.Extra[key] = append(file.Extra[key], value)
+				}
+			}
+		case flac.Picture:
+			pic, err := flacpicture.ParseFromMetaDataBlock(*m)
+			if err == nil && (cover == nil || pic.PictureType == flacpicture.PictureTypeFrontCover) {
+				cover = pic.ImageData
+			}
+		}
+	}
+	return cover, nil
+}
+
+func vorbisFieldName(key string) (string, bool) {
+	for _, field := range tagEditorFields {
+		if field.Vorbis == key {
+			return field.Name, true
+		}
+	}
+	return "", false
+}
+
+// cleanTagValues 去掉首尾空白和空值
+func cleanTagValues(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// ApplyTagEdits 按顺序应用编辑操作 返回修改后的副本 不会写入文件
+// 读取失败的文件保持不变 renumber 按 files 的顺序编号
+func ApplyTagEdits(files []TagFile, edits []TagEdit) ([]TagFile, error) {
+	result := make([]TagFile, 0, len(files))
+	for _, file := range files {
+		result = append(result, file.clone())
+	}
+	editable := make([]*TagFile, 0, len(result))
+	for i := range result {
+		if result[i].Error == "" {
+			editable = append(editable, &result[i])
+		}
+	}
+
+	for _, edit := range edits {
+		switch edit.Op {
+		case TagEditSet, TagEditReplace:
+			if _, ok := findTagField(edit.Field); !ok {
+				return nil, fmt.Errorf("%w: %s", TagFieldUnsupportedErr, edit.Field)
+			}
+		}
+
+		switch edit.Op {
+		case TagEditSet:
+			for _, file := range editable {
+				file.Fields[edit.Field] = cleanTagValues(edit.Values)
+			}
+		case TagEditReplace:
+			replace, err := newTagReplacer(edit)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range editable {
+				values := file.Fields[edit.Field]
+				for i := range values {
+					values[i] = replace(values[i])
+				}
+				file.Fields[edit.Field] = cleanTagValues(values)
+			}
+		case TagEditRenumber:
+			start := edit.Start
+			if start <= 0 {
+				start = 1
+			}
+			for i, file := range editable {
+				track := strconv.Itoa(start + i)
+				if edit.WithTotal {
+					track = fmt.Sprintf("%s/%d", track, start+len(editable)-1)
+				}
+				file.Fields[TagTrack] = []string{track}
+			}
+		case TagEditCover:
+			data, err := os.ReadFile(edit.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !isImage(data) {
+				return nil, TagCoverInvalidErr
+			}
+			cover := newTagCover(data)
+			for _, file := range editable {
+				file.Cover, file.CoverPath, file.RemoveCover = cover, edit.Path, false
+			}
+		case TagEditRemoveCover:
+			for _, file := range editable {
+				file.Cover, file.CoverPath, file.RemoveCover = nil, "", true
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", TagEditUnsupportedErr, edit.Op)
+		}
+	}
+	return result, nil
+}
+
+func newTagReplacer(edit TagEdit) (func(string) string, error) {
+	if edit.Find == "" {
+		return nil, fmt.Errorf("%w: empty find text", TagEditInvalidErr)
+	}
+	if !edit.Regexp {
+		return func(s string) string {
+			return strings.ReplaceAll(s, edit.Find, edit.Replace)
+		}, nil
+	}
+	re, err := regexp.Compile(edit.Find)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", TagEditInvalidErr, err)
+	}
+	return func(s string) string {
+		return re.ReplaceAllString(s, edit.Replace)
+	}, nil
+}
+
+// WriteTagFiles 写入多个文件 返回重新读取的标签 失败的文件设置 Error
+func WriteTagFiles(files []TagFile) []TagFile {
+	result := make([]TagFile, 0, len(files))
+	for _, file := range files {
+		if file.Error != "" {
+			result = append(result, file)
+			continue
+		}
+		if err := WriteTagFile(file); err != nil {
+			file.Error = err.Error()
+			result = append(result, file)
+			continue
+		}
+		written, err := ReadTagFile(file.Path)
+		if err != nil {
+			file.Error = err.Error()
+			written = &file
+		}
+		result = append(result, *written)
+	}
+	return result
+}
+
+// WriteTagFile 只修改和文件中不同的字段 其他标签保持不变
+// 先在同目录的临时文件中修改 成功后替换原文件 文件在读取后被修改时返回 TagFileChangedErr
+func WriteTagFile(file TagFile) error {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != file.Size || info.ModTime().UnixMilli() != file.ModTime {
+		return TagFileChangedErr
+	}
+
+	var cover []byte
+	if file.CoverPath != "" {
+		if cover, err = os.ReadFile(file.CoverPath); err != nil {
+			return err
+		}
+		if !isImage(cover) {
+			return TagCoverInvalidErr
+		}
+	}
+
+	tmp, err := copyToTemp(file.Path, info.Mode())
+	if err != nil {
+		return err
+	}
+	switch file.Format {
+	case "mp3":
+		err = writeMP3TagFile(tmp, file, cover)
+	case "flac":
+		err = writeFLACTagFile(tmp, file, cover)
+	default:
+		err = UnsupportedAudioErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, file.Path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// copyToTemp 复制到同目录下的临时文件 保证可以原子替换
+func copyToTemp(path string, mode os.FileMode) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(path), ".tagedit-*"+filepath.Ext(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Chmod(mode.Perm())
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+func writeMP3TagFile(path string, file TagFile, cover []byte) error {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return err
+	}
+	defer tag.Close()
+
+	for _, field := range tagEditorFields {
+		values, ok := file.Fields[field.Name]
+		if !ok {
+			continue
+		}
+		target := field.id3Target(tag)
+		values = cleanTagValues(values)
+		if equalTagValues(values, id3FieldValues(tag, target, field.Multiple)) {
+			continue
+		}
+		deleteId3Frame(tag, target)
+		if len(values) > 0 {
+			setId3Frame(tag, target, values, true)
+		}
+	}
+
+	if file.RemoveCover || cover != nil {
+		tag.DeleteFrames(tag.CommonID("Attached picture"))
+	}
+	if cover != nil {
+		tag.AddAttachedPicture(newId3Picture(cover))
+	}
+	return tag.Save()
+}
+
+// deleteId3Frame 删除文本帧 "COMM:描述" 和 "USLT:描述" 只删除描述相同的帧
+func deleteId3Frame(tag *id3v2.Tag, target string) {
+	id, description, ok := strings.Cut(target, ":")
+	frames := tag.GetFrames(id)
+	tag.DeleteFrames(id)
+	if !ok && id != "COMM" && id != "USLT" {
+		return
+	}
+	for _, frame := range frames {
+		switch f := frame.(type) {
+		case id3v2.CommentFrame:
+			if f.Description == description {
+				continue
+			}
+		case id3v2.UnsynchronisedLyricsFrame:
+			if f.ContentDescriptor == description {
+				continue
+			}
+		}
+		tag.AddFrame(id, frame)
+	}
+}
+
+func writeFLACTagFile(path string, file TagFile, cover []byte) error {
+	f, err := flac.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	if file.RemoveCover || cover != nil {
+		blocks := f.Meta[:0]
+		for _, m := range f.Meta {
+			if m.Type != flac.Picture {
+				blocks = append(blocks, m)
+			}
+		}
+		f.Meta = blocks
+	}
+	if cover != nil {
+		picturemeta, err := newFLACPicture(cover)
+		if err != nil {
+			return err
+		}
+		f.Meta = append(f.Meta, picturemeta)
+	}
+
+	var cmtmeta *flac.MetaDataBlock
+	for _, m := range f.Meta {
+		if m.Type == flac.VorbisComment {
+			cmtmeta = m
+			break
+		}
+	}
+	cmts := flacvorbis.New()
+	if cmtmeta != nil {
+		if cmts, err = flacvorbis.ParseFromMetaDataBlock(*cmtmeta); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range tagEditorFields {
+		values, ok := file.Fields[field.Name]
+		if !ok {
+			continue
+		}
+		values = cleanTagValues(values)
+		existing, err := cmts.Get(field.Vorbis)
+		if err != nil {
+			return err
+		}
+		if equalTagValues(values, cleanTagValues(existing)) {
+			continue
+		}
+		if err = setVorbisComment(cmts, field.Vorbis, values, true); err != nil {
+			return fmt.Errorf("set vorbis comment %s failed: %w", field.Vorbis, err)
+		}
+	}
+
+	res := cmts.Marshal()
+	if cmtmeta != nil {
+		*cmtmeta = res
+	} else {
+		f.Meta = append(f.Meta, &res)
+	}
+	return f.Save(path)
+}
+
+func equalTagValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bogem/id3v2"
+	"github.com/go-flac/flacvorbis"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeTestPNG(t *testing.T, path string) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTagEditor(t *testing.T) {
+	dir := t.TempDir()
+	mp3 := filepath.Join(dir, "b.mp3")
+	writeTestMP3(t, mp3, map[string]string{"TIT2": "晴天 (Live)", "TPE1": "周杰伦\x00杨瑞代", "TALB": "叶惠美"})
+	tag, err := id3v2.Open(mp3, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setId3Frame(tag, "TXXX:NETEASE_MUSIC_ID", []string{"186001"}, true)
+	setId3Frame(tag, "COMM", []string{"旧注释"}, true)
+	setId3Frame(tag, "COMM:NETEASE_ALBUM_ID", []string{"18905"}, true)
+	if err = tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	flacPath := filepath.Join(dir, "a.flac")
+	writeTestFLAC(t, flacPath, map[string]string{
+		flacvorbis.FIELD_TITLE: "七里香 (Live)",
+		flacvorbis.FIELD_ALBUM: "七里香",
+		"NETEASE_MUSIC_ID":     "186002",
+	})
+	cover := filepath.Join(dir, "cover.png")
+	writeTestPNG(t, cover)
+
+	files := ReadTagFiles([]string{flacPath, mp3, filepath.Join(dir, "missing.mp3")})
+	if files[2].Error == "" {
+		t.Fatal("expected read error for missing file")
+	}
+	if got := files[1].Fields[TagArtist]; !reflect.DeepEqual(got, []string{"周杰伦", "杨瑞代"}) {
+		t.Fatalf("unexpected mp3 artists %v", got)
+	}
+	if got := files[1].Fields[TagComment]; !reflect.DeepEqual(got, []string{"旧注释"}) {
+		t.Fatalf("unexpected mp3 comment %v", got)
+	}
+	wantExtra := map[string][]string{"TXXX:NETEASE_MUSIC_ID": {"186001"}, "COMM:NETEASE_ALBUM_ID": {"18905"}}
+	if !reflect.DeepEqual(files[1].Extra, wantExtra) {
+		t.Fatalf("unexpected mp3 extra %v", files[1].Extra)
+	}
+	if !reflect.DeepEqual(files[0].Extra, map[string][]string{"NETEASE_MUSIC_ID": {"186002"}}) {
+		t.Fatalf("unexpected flac extra %v", files[0].Extra)
+	}
+
+	edited, err := ApplyTagEdits(files, []TagEdit{
+		{Op: TagEditSet, Field: TagAlbumArtist, Values: []string{"周杰伦"}},
+		{Op: TagEditSet, Field: TagComment},
+		{Op: TagEditReplace, Field: TagTitle, Find: `\s*\(Live\)$`, Regexp: true},
+		{Op: TagEditRenumber, WithTotal: true},
+		{Op: TagEditCover, Path: cover},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 原来的标签不变
+	if got := files[1].Fields[TagTitle]; !reflect.DeepEqual(got, []string{"晴天 (Live)"}) {
+		t.Fatalf("expected original files unchanged, got %v", got)
+	}
+	if edited[1].Cover == nil || edited[1].Cover.MIME != "image/png" || edited[1].CoverPath != cover {
+		t.Fatalf("unexpected cover %+v", edited[1])
+	}
+
+	written := WriteTagFiles(edited)
+	want := []map[string][]string{
+		{TagTitle: {"七里香"}, TagAlbum: {"七里香"}, TagTrack: {"1/2"}, TagAlbumArtist: {"周杰伦"}, TagComment: {}},
+		{TagTitle: {"晴天"}, TagAlbum: {"叶惠美"}, TagTrack: {"2/2"}, TagAlbumArtist: {"周杰伦"}, TagComment: {}},
+	}
+	for i, fields := range want {
+		if written[i].Error != "" {
+			t.Fatalf("%s: %s", written[i].Path, written[i].Error)
+		}
+		for name, values := range fields {
+			if got := written[i].Fields[name]; !reflect.DeepEqual(got, values) {
+				t.Fatalf("%s %s: expected %v, got %v", written[i].Path, name, values, got)
+			}
+		}
+		if written[i].Cover == nil || written[i].Cover.Thumbnail == "" {
+			t.Fatalf("%s: expected cover", written[i].Path)
+		}
+	}
+	// 不支持的标签保持不变
+	if !reflect.DeepEqual(written[1].Extra, wantExtra) {
+		t.Fatalf("unexpected mp3 extra after write %v", written[1].Extra)
+	}
+	if written[2].Error == "" {
+		t.Fatal("expected missing file to keep error")
+	}
+
+	removed, err := ApplyTagEdits(written[:2], []TagEdit{{Op: TagEditRemoveCover}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range WriteTagFiles(removed) {
+		if file.Error != "" || file.Cover != nil {
+			t.Fatalf("expected cover removed, got %+v", file)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Fatalf("expected temp files removed, got %v", entries)
+	}
+}
+
+func TestWriteTagFileChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	writeTestMP3(t, path, map[string]string{"TIT2": "晴天"})
+	file, err := ReadTagFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Fields[TagTitle] = []string{"七里香"}
+
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteTagFile(*file); !errors.Is(err, TagFileChangedErr) {
+		t.Fatalf("expected TagFileChangedErr, got %v", err)
+	}
+	if tag, _ := ReadAudioTag(path); tag.Title != "晴天" {
+		t.Fatalf("expected file untouched, got %q", tag.Title)
+	}
+}
+
+func TestWriteTagFileV23(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetVersion(3)
+	tag.AddTextFrame("TIT2", id3v2.EncodingUTF16, "晴天 (Live)")
+	tag.AddTextFrame("TPE1", id3v2.EncodingUTF16, "周杰伦/杨瑞代")
+	if err = tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	file, err := ReadTagFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := file.Fields[TagArtist]; !reflect.DeepEqual(got, []string{"周杰伦", "杨瑞代"}) {
+		t.Fatalf("unexpected artists %v", got)
+	}
+	edited, err := ApplyTagEdits([]TagFile{*file}, []TagEdit{
+		{Op: TagEditSet, Field: TagArtist, Values: []string{"周杰伦", "五月天"}},
+		{Op: TagEditSet, Field: TagYear, Values: []string{"2003"}},
+		{Op: TagEditReplace, Field: TagTitle, Find: " (Live)"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteTagFile(edited[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err = ReadTagFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{TagTitle: {"晴天"}, TagArtist: {"周杰伦", "五月天"}, TagYear: {"2003"}}
+	for name, values := range want {
+		if got := file.Fields[name]; !reflect.DeepEqual(got, values) {
+			t.Fatalf("%s: expected %v, got %v", name, values, got)
+		}
+	}
+	tag, err = id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Version() != 3 {
+		t.Fatalf("expected v2.3 tag, got v2.%d", tag.Version())
+	}
+	for _, id := range []string{"TIT2", "TPE1", "TYER"} {
+		if frame := tag.GetTextFrame(id); !frame.Encoding.Equals(id3v2.EncodingUTF16) {
+			t.Fatalf("%s: expected UTF-16, got %v", id, frame.Encoding)
+		}
+	}
+	if got := tag.GetTextFrame("TPE1").Text; got != "周杰伦/五月天" {
+		t.Fatalf("expected artists joined with /, got %q", got)
+	}
+}
+
+func TestApplyTagEditsInvalid(t *testing.T) {
+	files := []TagFile{{Path: "a.mp3", Fields: map[string][]string{}}}
+	for _, tt := range []struct {
+		edit TagEdit
+		err  error
+	}{
+		{TagEdit{Op: TagEditSet, Field: "bitrate"}, TagFieldUnsupportedErr},
+		{TagEdit{Op: "sort"}, TagEditUnsupportedErr},
+		{TagEdit{Op: TagEditReplace, Field: TagTitle}, TagEditInvalidErr},
+		{TagEdit{Op: TagEditReplace, Field: TagTitle, Find: "(", Regexp: true}, TagEditInvalidErr},
+	} {
+		if _, err := ApplyTagEdits(files, []TagEdit{tt.edit}); !errors.Is(err, tt.err) {
+			t.Fatalf("%+v: expected %v, got %v", tt.edit, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"github.com/bogem/id3v2"
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var tagTestMeta = &MetaInfo{
+	MusicID:    186001,
+	MusicName:  "晴天",
+	Artist:     []NcmArtist{{Name: "周杰伦", ID: 6452}, {Name: "杨瑞代"}},
+	AlbumID:    18905,
+	Album:      "叶惠美",
+	BitRate:    320000,
+	Duration:   269000,
+	Alias:      []string{"Sunny Day"},
+	TransNames: []string{"晴朗的日子"},
+}
+
+func TestAddMP3Tag(t *testing.T) {
+	logger.InitLogger()
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	options := NewTagOptions(configs.TagConfig{
+		Id3: map[string]string{
+			TagMvID:    "",
+			TagAlbumID: "COMM:NETEASE_ALBUM_ID",
+		},
+	})
+	addMP3Tag(path, []byte("fake cover"), tagTestMeta, nil, options)
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+
+	frames := map[string]string{
+		"TIT2": "晴天",
+		"TALB": "叶惠美",
+		"TPE1": "周杰伦\x00杨瑞代",
+		"TLEN": "269000",
+		"TIT3": "Sunny Day; 晴朗的日子",
+	}
+	for id, want := range frames {
+		if got := tag.GetTextFrame(id).Text; got != want {
+			t.Fatalf("%s: expected %q, got %q", id, want, got)
+		}
+	}
+	if got := findUserDefinedText(tag, "NETEASE_MUSIC_ID"); got != "186001" {
+		t.Fatalf("expected music id 186001, got %q", got)
+	}
+	if got := findComment(tag, "NETEASE_ALBUM_ID"); got != "18905" {
+		t.Fatalf("expected album id comment 18905, got %q", got)
+	}
+	if got := findUserDefinedText(tag, "NETEASE_MV_ID"); got != "" {
+		t.Fatalf("expected disabled mv id, got %q", got)
+	}
+	if len(tag.GetFrames(tag.CommonID("Attached picture"))) != 1 {
+		t.Fatal("expected one cover")
+	}
+}
+
+func TestAddMP3TagKeepExisting(t *testing.T) {
+	logger.InitLogger()
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Original")
+	if err = tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	addMP3Tag(path, nil, tagTestMeta, nil, DefaultTagOptions())
+	tag, _ = id3v2.Open(path, id3v2.Options{Parse: true})
+	if got := tag.Title(); got != "Original" {
+		t.Fatalf("expected existing title to be kept, got %q", got)
+	}
+	tag.Close()
+
+	addMP3Tag(path, nil, tagTestMeta, nil, NewTagOptions(configs.TagConfig{Overwrite: true}))
+	tag, _ = id3v2.Open(path, id3v2.Options{Parse: true})
+	defer tag.Close()
+	if got := tag.Title(); got != "晴天" {
+		t.Fatalf("expected title to be overwritten, got %q", got)
+	}
+}
+
+func TestAddMP3TagV23(t *testing.T) {
+	logger.InitLogger()
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, []byte("fake mp3 audio"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetVersion(3)
+	tag.SetTitle("Original")
+	if err = tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	tag.Close()
+
+	options := NewTagOptions(configs.TagConfig{
+		Overwrite: true,
+		Id3:       map[string]string{TagAlbumID: "COMM:NETEASE_ALBUM_ID"},
+	})
+	if err = addMP3Tag(path, nil, tagTestMeta, nil, options); err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err = id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Version() != 3 {
+		t.Fatalf("expected v2.3 tag, got v2.%d", tag.Version())
+	}
+	// v2.3 不支持UTF-8 多个值用 "/" 分隔
+	for id, frames := range tag.AllFrames() {
+		for _, frame := range frames {
+			var encoding id3v2.Encoding
+			switch f := frame.(type) {
+			case id3v2.TextFrame:
+				encoding = f.Encoding
+			case id3v2.UserDefinedTextFrame:
+				encoding = f.Encoding
+			case id3v2.CommentFrame:
+				encoding = f.Encoding
+			default:
+				continue
+			}
+			if !encoding.Equals(id3v2.EncodingUTF16) {
+				t.Fatalf("%s: expected UTF-16, got %v", id, encoding)
+			}
+		}
+	}
+	if got := tag.GetTextFrame("TPE1").Text; got != "周杰伦/杨瑞代" {
+		t.Fatalf("expected artists joined with /, got %q", got)
+	}
+	if got := findComment(tag, "NETEASE_ALBUM_ID"); got != "18905" {
+		t.Fatalf("expected album id comment 18905, got %q", got)
+	}
+
+	audioTag, err := ReadAudioTag(path)
+	want := AudioTag{Title: "晴天", Artist: "周杰伦, 杨瑞代", Album: "叶惠美"}
+	if err != nil || audioTag != want {
+		t.Fatalf("expected %+v, got %+v %v", want, audioTag, err)
+	}
+}
+
+func TestAddFLACTag(t *testing.T) {
+	logger.InitLogger()
+	path := filepath.Join(t.TempDir(), "a.flac")
+	// 只有 STREAMINFO 的最小flac文件
+	data := append([]byte("fLaC"), 0x80, 0, 0, 34)
+	data = append(data, make([]byte, 34)...)
+	data = append(data, 0xff, 0xf8, 0x69, 0x08, 0x00)
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	addFLACTag(path, nil, tagTestMeta, &Lyrics{Text: "[00:01.00]晴天"}, DefaultTagOptions())
+
+	f, err := flac.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmts *flacvorbis.MetaDataBlockVorbisComment
+	for _, m := range f.Meta {
+		if m.Type == flac.VorbisComment {
+			if cmts, err = flacvorbis.ParseFromMetaDataBlock(*m); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if cmts == nil {
+		t.Fatal("vorbis comment not found")
+	}
+
+	fields := map[string][]string{
+		flacvorbis.FIELD_ARTIST: {"周杰伦", "杨瑞代"},
+		"LENGTH":                {"269000"},
+		"SUBTITLE":              {"Sunny Day; 晴朗的日子"},
+		"NETEASE_MUSIC_ID":      {"186001"},
+		"NETEASE_MV_ID":         {},
+		"LYRICS":                {"[00:01.00]晴天"},
+	}
+	for field, want := range fields {
+		got, _ := cmts.Get(field)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %v, got %v", field, want, got)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransformOptions 转换参数
+type TransformOptions struct {
+	// crc32校验模式 strict 校验失败时终止转换 lenient 仅记录警告
+	CrcCheck string
+	// 输出目录 为空时输出到源文件所在目录
+	OutputDir string
+	// 文件名模板
+	NameTemplate string
+	// 输出文件已存在时的处理策略
+	ConflictPolicy string
+	// 标签写入参数
+	Tag *TagOptions
+	// 封面获取 为空时只使用内嵌封面
+	Cover *CoverResolver
+	// 解密进度回调 为空时不上报
+	Progress func(progress TransformProgress)
+	// 转换成功后源文件的处理策略
+	SourcePolicy string
+	// 源文件归档目录 为空时使用默认目录
+	Archive *SourceArchive
+}
+
+// TransformProgress 单个文件的解密进度
+type TransformProgress struct {
+	File  string `json:"file"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+}
+
+// 每次读取并解密的数据大小
+var transformBufferSize = 1 << 20
+
+// 进度上报的最小间隔
+var progressInterval = 200 * time.Millisecond
+
+// NewTransformOptions 根据配置生成转换参数
+func NewTransformOptions(cfg configs.NcmConfig) *TransformOptions {
+	options := DefaultTransformOptions()
+	if cfg.CrcCheck != "" {
+		options.CrcCheck = cfg.CrcCheck
+	}
+	if cfg.NameTemplate != "" {
+		options.NameTemplate = cfg.NameTemplate
+	}
+	if cfg.ConflictPolicy != "" {
+		options.ConflictPolicy = cfg.ConflictPolicy
+	}
+	if cfg.SourcePolicy != "" {
+		options.SourcePolicy = cfg.SourcePolicy
+	}
+	options.OutputDir = cfg.OutputDir
+	options.Tag = NewTagOptions(cfg.Tag)
+	options.Cover = NewCoverResolver(cfg.CoverCacheDir, cfg.Offline)
+	return options
+}
+
+// DefaultTransformOptions 默认转换参数
+func DefaultTransformOptions() *TransformOptions {
+	return &TransformOptions{
+		CrcCheck:       configs.CrcCheckLenient,
+		NameTemplate:   DefaultNameTemplate,
+		ConflictPolicy: configs.ConflictOverwrite,
+		Tag:            DefaultTagOptions(),
+		SourcePolicy:   configs.SourceKeep,
+	}
+}
+
+// ProcessMusicFile 解密已注册格式的加密音乐 按文件名模板输出并写入标签
+// 返回值需要命名 否则 defer 中设置的耗时不会生效
+func ProcessMusicFile(ctx context.Context, name string, options *TransformOptions) (result TransformResult) {
+	if options == nil {
+		options = DefaultTransformOptions()
+	}
+	start := time.Now()
+	result = TransformResult{Input: name}
+	defer func() {
+		result.Duration = time.Since(start).Milliseconds()
+	}()
+
+	fp, err := os.Open(name)
+	if err != nil {
+		result.setError(err)
+		return result
+	}
+	defer fp.Close()
+
+	audio, decryptor, err := GetDecryptorRegistry().Open(fp, name)
+	if err != nil {
+		result.setError(err)
+		return result
+	}
+	result.Decryptor = decryptor.Name()
+
+	// 目前只有NCM有crc32校验
+	if checker, ok := audio.(interface{ CheckCrc() error }); ok {
+		if err = checker.CheckCrc(); err != nil {
+			if options.CrcCheck == configs.CrcCheckStrict {
+				result.setError(err)
+				return result
+			}
+			logger.Debug(fmt.Sprintf("%s: %v", name, err))
+			result.addWarning(err.Error())
+		}
+	}
+
+	reader := bufio.NewReaderSize(audio, transformBufferSize)
+	result.MetaFormat = audio.Format()
+	// 以解密后的文件头为准 元数据中的格式可能为空或者不正确
+	header, _ := reader.Peek(audioFormatHeaderSize)
+	format := SniffAudioFormat(header)
+	switch {
+	case format == "":
+		format = strings.ToLower(result.MetaFormat)
+		if format == "" {
+			format = "mp3"
+		}
+	case result.MetaFormat != "" && !strings.EqualFold(result.MetaFormat, format):
+		logger.Debug(fmt.Sprintf("%s: meta format %s, detected %s", name, result.MetaFormat, format))
+		result.addWarning(fmt.Sprintf("format mismatch: meta %s, detected %s", result.MetaFormat, format))
+	}
+	result.Format = format
+
+	meta := audio.Meta()
+	if meta == nil {
+		meta = &MetaInfo{}
+	}
+
+	outputName := BuildOutputPath(name, meta, format, options)
+	fpOut, outputName, err := createOutputFile(outputName, options.ConflictPolicy)
+	if errors.Is(err, OutputExistErr) {
+		logger.Debug(fmt.Sprintf("%s already exists, skipping", outputName))
+		result.Output = outputName
+		result.Skipped = true
+		return result
+	}
+	if err != nil {
+		result.setError(err)
+		return result
+	}
+
+	progress := &progressReader{
+		ctx:      ctx,
+		r:        reader,
+		progress: TransformProgress{File: name, Total: audio.AudioSize()},
+		report:   options.Progress,
+	}
+	// 隐藏 os.File 的 ReadFrom 使每次读取 transformBufferSize 字节 大块数据可以并行解密
+	written, err := io.CopyBuffer(struct{ io.Writer }{fpOut}, progress, make([]byte, transformBufferSize))
+	fpOut.Close()
+	progress.flush()
+	if err != nil {
+		os.Remove(outputName)
+		result.setError(err)
+		return result
+	}
+	result.Output = outputName
+	result.Bytes = written
+
+	logger.Debug(outputName)
+	cover := audio.Cover()
+	if options.Cover != nil && (format == "mp3" || format == "flac") {
+		cover = options.Cover.Resolve(name, cover, meta)
+	}
+	lyrics, err := LoadSidecarLyrics(name)
+	if err != nil {
+		logger.Error(fmt.Sprintf("load lyrics of %s failed: %v", name, err))
+		result.addWarning(fmt.Sprintf("load lyrics failed: %v", err))
+	}
+	var tagErr error
+	switch format {
+	case "mp3":
+		tagErr = addMP3Tag(outputName, cover, meta, lyrics, options.Tag)
+	case "flac":
+		tagErr = addFLACTag(outputName, cover, meta, lyrics, options.Tag)
+	}
+	result.Lyrics = lyrics != nil && tagErr == nil && (format == "mp3" || format == "flac")
+	if tagErr != nil {
+		logger.Error(fmt.Sprintf("write tag to %s failed: %v", outputName, tagErr))
+		result.addWarning(fmt.Sprintf("write tag failed: %v", tagErr))
+	}
+
+	result.SourcePolicy = configs.SourceKeep
+	if options.SourcePolicy == "" || options.SourcePolicy == configs.SourceKeep {
+		return result
+	}
+	// 输出文件校验通过后才删除或归档源文件
+	if err = verifyOutput(outputName, format, tagErr); err != nil {
+		result.addWarning(fmt.Sprintf("keep source: %v", err))
+		return result
+	}
+	fp.Close()
+	result.SourcePolicy, result.ArchiveID, err = handleSource(name, outputName, options.SourcePolicy, options.Archive)
+	if err != nil {
+		logger.Error(fmt.Sprintf("%s source %s failed: %v", options.SourcePolicy, name, err))
+		result.addWarning(fmt.Sprintf("%s source failed: %v", options.SourcePolicy, err))
+	}
+	return result
+}
+
+// progressReader 每次读取前检查ctx是否已取消 并按间隔上报进度
+type progressReader struct {
+	ctx      context.Context
+	r        io.Reader
+	progress TransformProgress
+	report   func(progress TransformProgress)
+	last     time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	p.progress.Done += int64(n)
+	if p.report != nil && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report(p.progress)
+	}
+	return n, err
+}
+
+func (p *progressReader) flush() {
+	if p.report != nil {
+		p.report(p.progress)
+	}
+}
+
+// TransformResult 单个文件的转换结果
+type TransformResult struct {
+	Input      string   `json:"input"`
+	Output     string   `json:"output"`
+	Decryptor  string   `json:"decryptor"`
+	Format     string   `json:"format"`      // 根据解密后的文件头识别 无法识别时使用元数据中的格式
+	MetaFormat string   `json:"meta_format"` // 元数据中记录的格式
+	Bytes      int64    `json:"bytes"`
+	Duration   int64    `json:"duration"` // 耗时 毫秒
+	Error      string   `json:"error"`
+	Warnings   []string `json:"warnings"`
+	// 输出文件已存在 按冲突策略跳过
+	Skipped bool `json:"skipped"`
+	// 是否写入了同名的 .lrc 歌词
+	Lyrics bool `json:"lyrics"`
+	// 实际执行的源文件处理策略 输出文件校验失败时为 keep
+	SourcePolicy string `json:"source_policy"`
+	// 归档时的ID 用于恢复源文件
+	ArchiveID string `json:"archive_id"`
+
+	Err error `json:"-"`
+}
+
+// Success 是否转换成功
+func (r *TransformResult) Success() bool {
+	return r.Err == nil
+}
+
+func (r *TransformResult) setError(err error) {
+	r.Err = err
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+func (r *TransformResult) addWarning(warning string) {
+	r.Warnings = append(r.Warnings, warning)
+}
+
+// TransformSummary 批量转换的汇总
+type TransformSummary struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Skipped   int               `json:"skipped"`
+	Canceled  int               `json:"canceled"`
+	Bytes     int64             `json:"bytes"`
+	Duration  int64             `json:"duration"` // 耗时 毫秒
+	Results   []TransformResult `json:"results"`
+	// 转换成功但没有写入歌词的文件
+	MissingLyrics []string `json:"missing_lyrics"`
+}
+
+// NewTransformSummary 根据每个文件的转换结果生成汇总
+func NewTransformSummary(results []TransformResult, elapsed time.Duration) TransformSummary {
+	summary := TransformSummary{
+		Total:    len(results),
+		Duration: elapsed.Milliseconds(),
+		Results:  results,
+	}
+	summary.MissingLyrics = make([]string, 0)
+	for i := range results {
+		if results[i].Skipped {
+			summary.Skipped++
+		} else if results[i].Success() {
+			summary.Succeeded++
+			summary.Bytes += results[i].Bytes
+			if !results[i].Lyrics {
+				summary.MissingLyrics = append(summary.MissingLyrics, results[i].Input)
+			}
+		} else if errors.Is(results[i].Err, context.Canceled) {
+			summary.Canceled++
+		} else {
+			summary.Failed++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewTransformSummary(t *testing.T) {
+	results := []TransformResult{
+		{Input: "a.ncm", Output: "a.mp3", Format: "mp3", Bytes: 100},
+		{Input: "b.ncm", Output: "b.flac", Format: "flac", Bytes: 200},
+		{Input: "c.ncm", Error: NotNcmFileErr.Error(), Err: NotNcmFileErr},
+	}
+
+	summary := NewTransformSummary(results, 1500*time.Millisecond)
+	if summary.Total != 3 || summary.Succeeded != 2 || summary.Failed != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if summary.Bytes != 300 {
+		t.Fatalf("expected 300 bytes, got %d", summary.Bytes)
+	}
+	if summary.Duration != 1500 {
+		t.Fatalf("expected 1500ms, got %d", summary.Duration)
+	}
+	if !errors.Is(summary.Results[2].Err, NotNcmFileErr) {
+		t.Fatalf("unexpected error %v", summary.Results[2].Err)
+	}
+}
+
+func writeKwmFile(t *testing.T, path string, plain []byte) {
+	header := make([]byte, kwmAudioOffset)
+	copy(header, "yeelion-kuwo-tme")
+	binary.LittleEndian.PutUint64(header[0x18:], 1234567890123)
+	copy(header[0x30:], "320OGG")
+
+	audio := append([]byte{}, plain...)
+	newKwmCipher(header[0x18:0x20]).Decrypt(audio, 0)
+	if err := os.WriteFile(path, append(header, audio...), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessMusicFileProgress(t *testing.T) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.kwm")
+	plain := bytes.Repeat([]byte("OggS kuwo audio "), 4096)
+	writeKwmFile(t, input, plain)
+
+	var last TransformProgress
+	options := DefaultTransformOptions()
+	options.Progress = func(progress TransformProgress) {
+		last = progress
+	}
+
+	result := ProcessMusicFile(context.Background(), input, options)
+	if !result.Success() {
+		t.Fatal(result.Err)
+	}
+	if last.File != input || last.Done != int64(len(plain)) || last.Total != int64(len(plain)) {
+		t.Fatalf("unexpected progress %+v", last)
+	}
+	got, err := os.ReadFile(result.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("decrypted audio mismatch")
+	}
+}
+
+func TestProcessMusicFileDuration(t *testing.T) {
+	logger.InitLogger()
+	input := filepath.Join(t.TempDir(), "a.kwm")
+	writeKwmFile(t, input, bytes.Repeat([]byte("OggS kuwo audio "), 64))
+
+	options := DefaultTransformOptions()
+	options.Progress = func(progress TransformProgress) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	result := ProcessMusicFile(context.Background(), input, options)
+	if !result.Success() {
+		t.Fatal(result.Err)
+	}
+	if result.Duration < 20 {
+		t.Fatalf("expected duration of at least 20ms, got %d", result.Duration)
+	}
+}
+
+func TestProcessMusicFileCancel(t *testing.T) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.kwm")
+	writeKwmFile(t, input, bytes.Repeat([]byte("OggS kuwo audio "), 4096))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	options := DefaultTransformOptions()
+	options.Progress = func(progress TransformProgress) {
+		cancel()
+	}
+	// 第一次上报进度时取消
+	progressInterval = 0
+	defer func() {
+		progressInterval = 200 * time.Millisecond
+	}()
+
+	result := ProcessMusicFile(ctx, input, options)
+	if !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", result.Err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.ogg")); !os.IsNotExist(err) {
+		t.Fatalf("expected partial output to be removed, got %v", err)
+	}
+
+	summary := NewTransformSummary([]TransformResult{result}, time.Second)
+	if summary.Canceled != 1 || summary.Failed != 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestProcessMusicFileSniffFormat(t *testing.T) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		metaFormat string
+		audio      []byte
+		wantFormat string
+		wantWarn   bool
+	}{
+		{"wrong.ncm", "flac", append([]byte{0xff, 0xfb, 0x90, 0x64}, testAudio(100)...), "mp3", true},
+		{"empty.ncm", "", append([]byte("OggS"), testAudio(100)...), "ogg", false},
+		// 无法识别时使用元数据中的格式 写入标签失败
+		{"unknown.ncm", "FLAC", testAudio(100), "flac", true},
+		{"same.ncm", "mp3", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), testAudio(100)...), "mp3", false},
+	}
+	for _, tt := range tests {
+		input := filepath.Join(dir, tt.name)
+		meta := &MetaInfo{MusicName: tt.name, Format: tt.metaFormat}
+		if err := os.WriteFile(input, encodeTestNcm(t, tt.audio, meta, nil), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		result := ProcessMusicFile(context.Background(), input, DefaultTransformOptions())
+		if !result.Success() {
+			t.Fatalf("%s: %v", tt.name, result.Err)
+		}
+		if result.Format != tt.wantFormat || result.MetaFormat != tt.metaFormat || (len(result.Warnings) > 0) != tt.wantWarn {
+			t.Fatalf("%s: unexpected result %+v", tt.name, result)
+		}
+		if filepath.Ext(result.Output) != "."+tt.wantFormat {
+			t.Fatalf("%s: unexpected output %s", tt.name, result.Output)
+		}
+	}
+}
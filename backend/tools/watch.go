@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/backend/pool"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"io/fs"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+var (
+	WatchNoDirErr           = errors.New("no directory to watch")
+	WatchModeUnsupportedErr = errors.New("watch mode is not supported on this platform")
+)
+
+var (
+	// 轮询模式下扫描目录的间隔
+	defaultWatchInterval = 5 * time.Second
+	// 文件大小和修改时间保持不变多久后认为已写完
+	defaultWatchSettleTime = 3 * time.Second
+	// 检查等待中的文件是否已写完的间隔
+	watchCheckInterval = time.Second
+)
+
+// WatchOptions 监听参数
+type WatchOptions struct {
+	Dirs      []string
+	Recursive bool
+	// auto poll inotify
+	Mode       string
+	Interval   time.Duration
+	SettleTime time.Duration
+	// 同时转换的文件数
+	Workers int
+}
+
+// NewWatchOptions 根据配置生成监听参数
+func NewWatchOptions(cfg configs.WatchConfig) WatchOptions {
+	return WatchOptions{
+		Dirs:       cfg.Dirs,
+		Recursive:  cfg.Recursive,
+		Mode:       cfg.Mode,
+		Interval:   time.Duration(cfg.Interval) * time.Second,
+		SettleTime: time.Duration(cfg.SettleTime) * time.Second,
+	}
+}
+
+// fileNotifier 文件变化通知 Events 返回变化的文件或目录
+type fileNotifier interface {
+	Events() <-chan string
+	Close() error
+}
+
+// Watcher 监听文件夹 新增的加密音乐写完后调用 handle 转换
+// 处理过的文件记录在 journal 中 路径、大小和修改时间都不变时不再处理
+type Watcher struct {
+	options WatchOptions
+	journal *WatchJournal
+	handle  func(ctx context.Context, path string) TransformResult
+
+	// 等待写完的文件
+	pending map[string]*pendingFile
+}
+
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	// 最后一次发生变化的时间
+	changed time.Time
+}
+
+func NewWatcher(options WatchOptions, journal *WatchJournal, handle func(ctx context.Context, path string) TransformResult) *Watcher {
+	if options.Interval <= 0 {
+		options.Interval = defaultWatchInterval
+	}
+	if options.SettleTime <= 0 {
+		options.SettleTime = defaultWatchSettleTime
+	}
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+	return &Watcher{
+		options: options,
+		journal: journal,
+		handle:  handle,
+		pending: make(map[string]*pendingFile),
+	}
+}
+
+// Run 开始监听 阻塞直到ctx取消
+func (w *Watcher) Run(ctx context.Context) error {
+	if len(w.options.Dirs) == 0 {
+		return WatchNoDirErr
+	}
+
+	mode := w.options.Mode
+	if mode == "" || mode == configs.WatchModeAuto {
+		mode = configs.WatchModePoll
+		if runtime.GOOS == "linux" {
+			mode = configs.WatchModeInotify
+		}
+	}
+
+	var events <-chan string
+	if mode == configs.WatchModeInotify {
+		notifier, err := newFileNotifier(w.options.Dirs, w.options.Recursive)
+		if err != nil {
+			if w.options.Mode == configs.WatchModeInotify {
+				return err
+			}
+			logger.Error(fmt.Sprintf("inotify unavailable, fallback to polling: %v", err))
+			mode = configs.WatchModePoll
+		} else {
+			defer notifier.Close()
+			events = notifier.Events()
+		}
+	}
+
+	// 启动时扫描一次 处理监听开始前已存在的文件
+	for _, dir := range w.options.Dirs {
+		w.scan(ctx, dir)
+	}
+
+	var poll <-chan time.Time
+	if mode == configs.WatchModePoll {
+		ticker := time.NewTicker(w.options.Interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	check := time.NewTicker(w.checkInterval())
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case path, ok := <-events:
+			if !ok {
+				return errors.New("file notifier closed")
+			}
+			w.add(ctx, path)
+		case <-poll:
+			for _, dir := range w.options.Dirs {
+				w.scan(ctx, dir)
+			}
+		case now := <-check.C:
+			w.convert(ctx, w.settled(now))
+		}
+	}
+}
+
+func (w *Watcher) checkInterval() time.Duration {
+	if w.options.SettleTime < watchCheckInterval {
+		return w.options.SettleTime
+	}
+	return watchCheckInterval
+}
+
+// scan 把目录下未处理的文件加入等待列表
+func (w *Watcher) scan(ctx context.Context, dir string) {
+	options := ScanOptions{Recursive: w.options.Recursive, SkipHidden: true}
+	err := ScanMusicFiles(ctx, dir, options, func(path string, info fs.FileInfo) error {
+		w.track(path, info)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		logger.Error(fmt.Sprintf("watch scan %s failed: %v", dir, err))
+	}
+}
+
+// add 处理文件变化通知 目录变化时重新扫描该目录
+func (w *Watcher) add(ctx context.Context, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(w.pending, path)
+		return
+	}
+	if info.IsDir() {
+		w.scan(ctx, path)
+		return
+	}
+	if info.Mode().IsRegular() && IsEncryptedMusic(path) {
+		w.track(path, info)
+	}
+}
+
+func (w *Watcher) track(path string, info fs.FileInfo) {
+	if w.journal.Processed(path, info.Size(), info.ModTime()) {
+		return
+	}
+	if file, ok := w.pending[path]; ok && file.size == info.Size() && file.modTime.Equal(info.ModTime()) {
+		return
+	}
+	w.pending[path] = &pendingFile{size: info.Size(), modTime: info.ModTime(), changed: time.Now()}
+}
+
+// settled 返回已写完的文件 文件有变化时重新计时
+func (w *Watcher) settled(now time.Time) []string {
+	paths := make([]string, 0)
+	for path, file := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		if info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+			file.size, file.modTime, file.changed = info.Size(), info.ModTime(), now
+			continue
+		}
+		if file.size > 0 && now.Sub(file.changed) >= w.options.SettleTime {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// convert 转换已写完的文件并记录到 journal 中 取消的文件下次启动时重新处理
+func (w *Watcher) convert(ctx context.Context, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	files := make([]pendingFile, len(paths))
+	for i, path := range paths {
+		files[i] = *w.pending[path]
+		delete(w.pending, path)
+	}
+
+	p := pool.New[TransformResult](ctx, w.options.Workers)
+	for _, path := range paths {
+		path := path
+		p.Submit(func(ctx context.Context) (TransformResult, error) {
+			result := w.handle(ctx, path)
+			return result, result.Err
+		})
+	}
+	for _, r := range p.Wait() {
+		if r.Err != nil && errors.Is(r.Err, context.Canceled) {
+			continue
+		}
+		result := r.Value
+		if result.Input == "" {
+			result = TransformResult{Input: paths[r.Index]}
+			result.setError(r.Err)
+		}
+		file := files[r.Index]
+		if err := w.journal.Record(paths[r.Index], file.size, file.modTime, result); err != nil {
+			logger.Error(fmt.Sprintf("record watch journal failed: %v", err))
+		}
+	}
+}
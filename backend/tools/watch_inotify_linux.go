@@ -0,0 +1,148 @@
+//go:build linux
+
+package tools
+
+import (
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// 写完关闭、移入、新建 新建目录时需要添加监听
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_MODIFY
+
+// inotifyNotifier 基于inotify的文件变化通知
+type inotifyNotifier struct {
+	fd   int
+	file *os.File
+
+	recursive bool
+	roots     []string
+	// watch descriptor -> 目录 只在读取事件的协程中修改
+	watches map[int32]string
+
+	events chan string
+	done   chan struct{}
+}
+
+func newFileNotifier(dirs []string, recursive bool) (fileNotifier, error) {
+	// 非阻塞的fd 读取时由运行时调度 Close 可以结束阻塞中的 Read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	n := &inotifyNotifier{
+		fd:        fd,
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		recursive: recursive,
+		roots:     dirs,
+		watches:   make(map[int32]string),
+		events:    make(chan string, 64),
+		done:      make(chan struct{}),
+	}
+	for _, dir := range dirs {
+		if err = n.addDir(dir); err != nil {
+			n.file.Close()
+			return nil, err
+		}
+	}
+	go n.readEvents()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Events() <-chan string {
+	return n.events
+}
+
+func (n *inotifyNotifier) Close() error {
+	close(n.done)
+	return n.file.Close()
+}
+
+// addDir 监听目录 recursive 时同时监听子目录
+func (n *inotifyNotifier) addDir(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", fmt.Errorf("%s: %w", dir, err))
+	}
+	n.watches[int32(wd)] = dir
+	if !n.recursive {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if err = n.addDir(filepath.Join(dir, entry.Name())); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+	return nil
+}
+
+func (n *inotifyNotifier) readEvents() {
+	defer close(n.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		c, err := n.file.Read(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+			default:
+				logger.Error(fmt.Sprintf("read inotify events failed: %v", err))
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= c; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+
+			var paths []string
+			switch {
+			case event.Mask&syscall.IN_Q_OVERFLOW != 0:
+				// 事件队列溢出 重新扫描所有目录
+				paths = n.roots
+			case event.Mask&syscall.IN_IGNORED != 0:
+				delete(n.watches, event.Wd)
+				continue
+			case event.Mask&syscall.IN_ISDIR != 0:
+				dir, ok := n.watches[event.Wd]
+				if !ok || !n.recursive || event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 {
+					continue
+				}
+				path := filepath.Join(dir, name)
+				if err = n.addDir(path); err != nil {
+					logger.Error(err.Error())
+				}
+				// 添加监听之前写入的文件需要扫描
+				paths = []string{path}
+			default:
+				dir, ok := n.watches[event.Wd]
+				if !ok || !IsEncryptedMusic(name) {
+					continue
+				}
+				paths = []string{filepath.Join(dir, name)}
+			}
+
+			for _, path := range paths {
+				select {
+				case n.events <- path:
+				case <-n.done:
+					return
+				}
+			}
+		}
+	}
+}
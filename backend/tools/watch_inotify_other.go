@@ -0,0 +1,7 @@
+//go:build !linux
+
+package tools
+
+func newFileNotifier(dirs []string, recursive bool) (fileNotifier, error) {
+	return nil, WatchModeUnsupportedErr
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultWatchJournalName 监听文件夹的处理记录 放在 ~/.tools_collection 下
+var DefaultWatchJournalName = "watch_journal.jsonl"
+
+// WatchJournalEntry 一个文件的处理记录
+type WatchJournalEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"` // 纳秒时间戳
+	Output  string `json:"output"`
+	Error   string `json:"error"`
+	Time    int64  `json:"time"` // 处理时间 秒
+}
+
+// WatchJournal 已处理文件的记录 每行一条JSON 追加写入
+// 转换失败的文件也会记录 文件被修改后重新处理
+type WatchJournal struct {
+	mux     sync.Mutex
+	path    string
+	entries map[string]WatchJournalEntry
+}
+
+// OpenWatchJournal 读取处理记录 path 为空时使用 ~/.tools_collection/watch_journal.jsonl
+func OpenWatchJournal(path string) (*WatchJournal, error) {
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(homeDir, ".tools_collection", DefaultWatchJournalName)
+	}
+	j := &WatchJournal{
+		path:    path,
+		entries: make(map[string]WatchJournalEntry),
+	}
+
+	fp, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry WatchJournalEntry
+		// 忽略写入中断导致的不完整的行
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Debug(fmt.Sprintf("skip broken watch journal line: %v", err))
+			continue
+		}
+		j.entries[entry.Path] = entry
+	}
+	return j, scanner.Err()
+}
+
+// Processed 文件是否已处理过
+func (j *WatchJournal) Processed(path string, size int64, modTime time.Time) bool {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	entry, ok := j.entries[path]
+	return ok && entry.Size == size && entry.ModTime == modTime.UnixNano()
+}
+
+// Record 记录转换结果
+func (j *WatchJournal) Record(path string, size int64, modTime time.Time, result TransformResult) error {
+	entry := WatchJournalEntry{
+		Path:    path,
+		Size:    size,
+		ModTime: modTime.UnixNano(),
+		Output:  result.Output,
+		Error:   result.Error,
+		Time:    time.Now().Unix(),
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	j.entries[path] = entry
+
+	if err = os.MkdirAll(filepath.Dir(j.path), os.ModePerm); err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = fp.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"github.com/wanyuqin/tool-collection/configs"
+	"github.com/wanyuqin/tool-collection/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runTestWatcher 启动监听 返回获取已转换文件和停止监听的函数
+func runTestWatcher(t *testing.T, mode string, dir, journalPath string) (func() []string, func()) {
+	journal, err := OpenWatchJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mux sync.Mutex
+	converted := make([]string, 0)
+	options := WatchOptions{
+		Dirs:       []string{dir},
+		Recursive:  true,
+		Mode:       mode,
+		Interval:   20 * time.Millisecond,
+		SettleTime: 200 * time.Millisecond,
+	}
+	watcher := NewWatcher(options, journal, func(ctx context.Context, path string) TransformResult {
+		result := ProcessMusicFile(ctx, path, DefaultTransformOptions())
+		mux.Lock()
+		converted = append(converted, path)
+		mux.Unlock()
+		return result
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watcher.Run(ctx)
+	}()
+	stop := func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Fatalf("unexpected watcher error %v", err)
+		}
+	}
+	get := func() []string {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]string{}, converted...)
+	}
+	return get, stop
+}
+
+func waitConverted(t *testing.T, get func() []string, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := get(); len(got) >= n {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d converted files, got %v", n, get())
+	return nil
+}
+
+func testWatcher(t *testing.T, mode string) {
+	logger.InitLogger()
+	dir := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), DefaultWatchJournalName)
+	data := encodeTestNcm(t, testAudio(1024), &MetaInfo{Format: "mp3"}, nil)
+
+	// 监听开始前已存在的文件
+	if err := os.WriteFile(filepath.Join(dir, "a.ncm"), data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	get, stop := runTestWatcher(t, mode, dir, journalPath)
+	waitConverted(t, get, 1)
+
+	// 分两次写入 写完之后才转换
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(sub, "b.ncm")
+	if err := os.WriteFile(input, data[:len(data)/2], 0666); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	fp, err := os.OpenFile(input, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.Write(data[len(data)/2:])
+	fp.Close()
+
+	got := waitConverted(t, get, 2)
+	stop()
+	if len(got) != 2 || got[1] != input {
+		t.Fatalf("unexpected converted files %v", got)
+	}
+	if _, err = os.Stat(filepath.Join(sub, "b.mp3")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新启动后已处理的文件不再转换
+	get, stop = runTestWatcher(t, mode, dir, journalPath)
+	time.Sleep(500 * time.Millisecond)
+	stop()
+	if got = get(); len(got) != 0 {
+		t.Fatalf("expected no conversion after restart, got %v", got)
+	}
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	testWatcher(t, configs.WatchModePoll)
+}
+
+func TestWatcher_Inotify(t *testing.T) {
+	if _, err := newFileNotifier([]string{t.TempDir()}, false); err != nil {
+		t.Skip(err)
+	}
+	testWatcher(t, configs.WatchModeInotify)
+}
+
+func TestWatchJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenWatchJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Unix(1700000000, 123)
+	if err = journal.Record("/a.ncm", 100, modTime, TransformResult{Output: "/a.mp3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不完整的行被忽略
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.WriteString(`{"path":"/b.n`)
+	fp.Close()
+
+	journal, err = OpenWatchJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !journal.Processed("/a.ncm", 100, modTime) {
+		t.Fatal("expected processed")
+	}
+	if journal.Processed("/a.ncm", 101, modTime) || journal.Processed("/b.ncm", 100, modTime) {
+		t.Fatal("expected modified or unknown file to be unprocessed")
+	}
+}
@@ -21,12 +21,102 @@ var (
 	DefaultDownloadPath = "tools_collection"
 )
 
+// crc32校验模式
+const (
+	CrcCheckStrict  = "strict"
+	CrcCheckLenient = "lenient"
+)
+
+// 转换成功后源文件的处理策略 archive 移到 ~/.tools_collection/archive 可以恢复
+const (
+	SourceKeep    = "keep"
+	SourceDelete  = "delete"
+	SourceArchive = "archive"
+)
+
+// 监听文件夹的方式 auto 在linux上使用inotify 其他系统轮询
+const (
+	WatchModeAuto    = "auto"
+	WatchModePoll    = "poll"
+	WatchModeInotify = "inotify"
+)
+
+// 输出文件已存在时的处理策略
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+// 默认选择的清晰度 best:1080 表示不超过1080p的最大清晰度
+const (
+	StreamBest     = "best"
+	StreamSmallest = "smallest"
+)
+
 type Config struct {
 	Download DownloadConfig `json:"download" yaml:"download"`
+	Ncm      NcmConfig      `json:"ncm" yaml:"ncm"`
 }
 
 type DownloadConfig struct {
 	Path string `json:"path" yaml:"path"`
+	// 同时下载的分片数 0 使用默认值
+	Threads int `json:"threads" yaml:"threads"`
+	// 同时下载的任务数 0 使用默认值 超过的任务排队等待
+	MaxActive int `json:"max_active" yaml:"max_active"`
+	// 默认选择的清晰度 best smallest 或 best:1080 为空时使用 best
+	Stream string `json:"stream" yaml:"stream"`
+	// 启动时自动继续上次未完成的下载 否则询问
+	AutoResume bool `json:"auto_resume" yaml:"auto_resume"`
+}
+
+// NcmConfig 音乐解密设置
+type NcmConfig struct {
+	// crc32校验模式 strict 或 lenient
+	CrcCheck string `json:"crc_check" yaml:"crc_check"`
+	// 输出目录 为空时输出到源文件所在目录
+	OutputDir string `json:"output_dir" yaml:"output_dir"`
+	// 文件名模板 如 {artist}/{album}/{track} - {title}.{ext}
+	NameTemplate string `json:"name_template" yaml:"name_template"`
+	// 输出文件已存在时的处理策略 skip overwrite rename
+	ConflictPolicy string `json:"conflict_policy" yaml:"conflict_policy"`
+	// 同时转换的文件数 0 使用CPU核数
+	Workers int `json:"workers" yaml:"workers"`
+	// 标签写入设置
+	Tag TagConfig `json:"tag" yaml:"tag"`
+	// 离线模式 不下载封面
+	Offline bool `json:"offline" yaml:"offline"`
+	// 封面缓存目录 为空时使用 ~/.tools_collection/covers
+	CoverCacheDir string `json:"cover_cache_dir" yaml:"cover_cache_dir"`
+	// 转换成功后源文件的处理策略 keep delete archive
+	SourcePolicy string `json:"source_policy" yaml:"source_policy"`
+	// 监听文件夹设置
+	Watch WatchConfig `json:"watch" yaml:"watch"`
+}
+
+// WatchConfig 监听文件夹 自动转换新增的加密音乐
+type WatchConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	Dirs    []string `json:"dirs" yaml:"dirs"`
+	// 是否监听子目录
+	Recursive bool `json:"recursive" yaml:"recursive"`
+	// auto poll inotify
+	Mode string `json:"mode" yaml:"mode"`
+	// 轮询间隔 秒 0 使用默认值
+	Interval int `json:"interval" yaml:"interval"`
+	// 文件大小和修改时间保持不变多少秒后认为已写完 0 使用默认值
+	SettleTime int `json:"settle_time" yaml:"settle_time"`
+}
+
+// TagConfig 标签写入设置
+type TagConfig struct {
+	// 是否覆盖文件中已有的标签 默认保留
+	Overwrite bool `json:"overwrite" yaml:"overwrite"`
+	// 元数据字段到 ID3v2 帧的映射 如 music_id: "TXXX:NETEASE_MUSIC_ID", 值为空时不写入该字段
+	Id3 map[string]string `json:"id3" yaml:"id3"`
+	// 元数据字段到 Vorbis comment 字段的映射
+	Vorbis map[string]string `json:"vorbis" yaml:"vorbis"`
 }
 
 func GetConfig() Config {
@@ -53,7 +143,18 @@ func LoadConfig() Config {
 func SaveDownloadSettings(downloadConfig DownloadConfig) error {
 	cfg := LoadConfig()
 	cfg.Download = downloadConfig
+	return SaveConfig(cfg)
+}
+
+// SaveNcmSettings 保存音乐解密设置
+func SaveNcmSettings(ncmConfig NcmConfig) error {
+	cfg := LoadConfig()
+	cfg.Ncm = ncmConfig
+	return SaveConfig(cfg)
+}
 
+// SaveConfig 写入配置文件
+func SaveConfig(cfg Config) error {
 	body, err := yaml.Marshal(cfg)
 	if err != nil {
 		logger.Error(err.Error())
@@ -65,12 +166,11 @@ func SaveDownloadSettings(downloadConfig DownloadConfig) error {
 		return err
 	}
 	file, err := os.OpenFile(configPath, os.O_TRUNC|os.O_WRONLY, 0666)
-	defer file.Close()
-
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
+	defer file.Close()
 
 	_, err = file.Write(body)
 	if err != nil {
@@ -107,6 +207,15 @@ func InitConfigFile(rootPath string) error {
 			Download: DownloadConfig{
 				Path: downloadPath,
 			},
+			Ncm: NcmConfig{
+				CrcCheck:       CrcCheckLenient,
+				NameTemplate:   "{name}.{ext}",
+				ConflictPolicy: ConflictOverwrite,
+				SourcePolicy:   SourceKeep,
+				Watch: WatchConfig{
+					Mode: WatchModeAuto,
+				},
+			},
 		}
 
 		cfgByte, err := yaml.Marshal(cfg)
@@ -8,6 +8,8 @@ import App from './App.vue'
 import DownloadTools from "./views/DownloadTool.vue"
 import NcmTool from "./views/ncmTool.vue"
 import DownloadSettings from './views/DownloadSettings.vue'
+import OrganizeTool from './views/OrganizeTool.vue'
+import TagEditor from './views/TagEditor.vue'
 
 const router = createRouter({
     history: createWebHashHistory(),
@@ -15,6 +17,10 @@ const router = createRouter({
         path: '/downloadTools', component: DownloadTools
     }, {
         path: '/ncmTools', component: NcmTool
+    }, {
+        path: '/organizeTools', component: OrganizeTool
+    }, {
+        path: '/tagEditor', component: TagEditor
     }, {
         path: '/downloadSettings', component: DownloadSettings
     }
@@ -4,20 +4,82 @@ import {tools} from '../models';
 import {configs} from '../models';
 import {main} from '../models';
 
+export function AddWatchDirectory():Promise<configs.WatchConfig>;
+
+export function ApplyOrganize(arg1:tools.OrganizePlan):Promise<tools.OrganizeResult>;
+
 export function CancelDownload(arg1:string):Promise<void>;
 
+export function CancelTransform():Promise<void>;
+
+export function ClearDownloadHistory():Promise<void>;
+
+export function DeleteDownloadHistory(arg1:Array<string>):Promise<void>;
+
+export function DiscardDownloads(arg1:Array<string>):Promise<void>;
+
 export function Download(arg1:tools.ExtractLinkData):Promise<void>;
 
-export function DownloadHistory():Promise<void>;
+export function DownloadHistory(arg1:tools.DownloadHistoryQuery):Promise<tools.DownloadHistoryPage>;
 
 export function ExtractLink(arg1:string):Promise<Array<tools.ExtractLinkData>>;
 
 export function GetDownloadSettings():Promise<configs.DownloadConfig>;
 
+export function GetNcmSettings():Promise<configs.NcmConfig>;
+
+export function GetQueue():Promise<Array<tools.DownloadQueueItem>>;
+
 export function Greet(arg1:string):Promise<string>;
 
+export function InspectNcm(arg1:string):Promise<tools.NcmInfo>;
+
+export function ListArchivedSources():Promise<Array<tools.ArchiveEntry>>;
+
+export function ListOrganizeHistory():Promise<Array<tools.OrganizeBatchInfo>>;
+
+export function MoveDownloadDown(arg1:string):Promise<void>;
+
+export function MoveDownloadUp(arg1:string):Promise<void>;
+
+export function PauseDownload(arg1:string):Promise<void>;
+
+export function PlanOrganize(arg1:string,arg2:tools.ScanOptions):Promise<tools.OrganizePlan>;
+
+export function PreviewTagEdits(arg1:Array<tools.TagFile>,arg2:Array<tools.TagEdit>):Promise<Array<tools.TagFile>>;
+
+export function ReadTags(arg1:Array<string>):Promise<Array<tools.TagFile>>;
+
+export function Redownload(arg1:string):Promise<Array<tools.ExtractLinkData>>;
+
+export function RestoreSource(arg1:string):Promise<string>;
+
+export function ResumeDownload(arg1:string):Promise<void>;
+
+export function ResumeDownloads(arg1:Array<string>):Promise<Array<tools.ExtractLinkData>>;
+
 export function SaveDownloadSettings(arg1:configs.DownloadConfig):Promise<void>;
 
-export function SelectDirectory():Promise<Array<main.NcmFile>>;
+export function SaveNcmSettings(arg1:configs.NcmConfig):Promise<void>;
+
+export function SelectCoverImage():Promise<string>;
+
+export function SelectDirectory(arg1:tools.ScanOptions):Promise<Array<main.NcmFile>>;
+
+export function SelectOrganizeDirectory(arg1:tools.ScanOptions):Promise<tools.OrganizePlan>;
+
+export function SelectTagFiles():Promise<Array<tools.TagFile>>;
+
+export function SetDownloadPriority(arg1:string,arg2:number):Promise<void>;
+
+export function StartWatch():Promise<void>;
+
+export function StopWatch():Promise<void>;
+
+export function Transform(arg1:Array<main.NcmFile>):Promise<tools.TransformSummary>;
+
+export function UndoOrganize(arg1:string):Promise<number>;
+
+export function UnfinishedDownloads():Promise<Array<tools.DownloadTask>>;
 
-export function Transform(arg1:Array<main.NcmFile>):Promise<void>;
+export function WriteTags(arg1:Array<tools.TagFile>):Promise<Array<tools.TagFile>>;
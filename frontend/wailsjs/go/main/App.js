@@ -2,16 +2,40 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddWatchDirectory() {
+  return window['go']['main']['App']['AddWatchDirectory']();
+}
+
+export function ApplyOrganize(arg1) {
+  return window['go']['main']['App']['ApplyOrganize'](arg1);
+}
+
 export function CancelDownload(arg1) {
   return window['go']['main']['App']['CancelDownload'](arg1);
 }
 
+export function CancelTransform() {
+  return window['go']['main']['App']['CancelTransform']();
+}
+
+export function ClearDownloadHistory() {
+  return window['go']['main']['App']['ClearDownloadHistory']();
+}
+
+export function DeleteDownloadHistory(arg1) {
+  return window['go']['main']['App']['DeleteDownloadHistory'](arg1);
+}
+
+export function DiscardDownloads(arg1) {
+  return window['go']['main']['App']['DiscardDownloads'](arg1);
+}
+
 export function Download(arg1) {
   return window['go']['main']['App']['Download'](arg1);
 }
 
-export function DownloadHistory() {
-  return window['go']['main']['App']['DownloadHistory']();
+export function DownloadHistory(arg1) {
+  return window['go']['main']['App']['DownloadHistory'](arg1);
 }
 
 export function ExtractLink(arg1) {
@@ -22,18 +46,118 @@ export function GetDownloadSettings() {
   return window['go']['main']['App']['GetDownloadSettings']();
 }
 
+export function GetNcmSettings() {
+  return window['go']['main']['App']['GetNcmSettings']();
+}
+
+export function GetQueue() {
+  return window['go']['main']['App']['GetQueue']();
+}
+
 export function Greet(arg1) {
   return window['go']['main']['App']['Greet'](arg1);
 }
 
+export function InspectNcm(arg1) {
+  return window['go']['main']['App']['InspectNcm'](arg1);
+}
+
+export function ListArchivedSources() {
+  return window['go']['main']['App']['ListArchivedSources']();
+}
+
+export function ListOrganizeHistory() {
+  return window['go']['main']['App']['ListOrganizeHistory']();
+}
+
+export function MoveDownloadDown(arg1) {
+  return window['go']['main']['App']['MoveDownloadDown'](arg1);
+}
+
+export function MoveDownloadUp(arg1) {
+  return window['go']['main']['App']['MoveDownloadUp'](arg1);
+}
+
+export function PauseDownload(arg1) {
+  return window['go']['main']['App']['PauseDownload'](arg1);
+}
+
+export function PlanOrganize(arg1,arg2) {
+  return window['go']['main']['App']['PlanOrganize'](arg1,arg2);
+}
+
+export function PreviewTagEdits(arg1,arg2) {
+  return window['go']['main']['App']['PreviewTagEdits'](arg1,arg2);
+}
+
+export function ReadTags(arg1) {
+  return window['go']['main']['App']['ReadTags'](arg1);
+}
+
+export function Redownload(arg1) {
+  return window['go']['main']['App']['Redownload'](arg1);
+}
+
+export function RestoreSource(arg1) {
+  return window['go']['main']['App']['RestoreSource'](arg1);
+}
+
+export function ResumeDownload(arg1) {
+  return window['go']['main']['App']['ResumeDownload'](arg1);
+}
+
+export function ResumeDownloads(arg1) {
+  return window['go']['main']['App']['ResumeDownloads'](arg1);
+}
+
 export function SaveDownloadSettings(arg1) {
   return window['go']['main']['App']['SaveDownloadSettings'](arg1);
 }
 
-export function SelectDirectory() {
-  return window['go']['main']['App']['SelectDirectory']();
+export function SaveNcmSettings(arg1) {
+  return window['go']['main']['App']['SaveNcmSettings'](arg1);
+}
+
+export function SelectCoverImage() {
+  return window['go']['main']['App']['SelectCoverImage']();
+}
+
+export function SelectDirectory(arg1) {
+  return window['go']['main']['App']['SelectDirectory'](arg1);
+}
+
+export function SelectOrganizeDirectory(arg1) {
+  return window['go']['main']['App']['SelectOrganizeDirectory'](arg1);
+}
+
+export function SelectTagFiles() {
+  return window['go']['main']['App']['SelectTagFiles']();
+}
+
+export function SetDownloadPriority(arg1,arg2) {
+  return window['go']['main']['App']['SetDownloadPriority'](arg1,arg2);
+}
+
+export function StartWatch() {
+  return window['go']['main']['App']['StartWatch']();
+}
+
+export function StopWatch() {
+  return window['go']['main']['App']['StopWatch']();
 }
 
 export function Transform(arg1) {
   return window['go']['main']['App']['Transform'](arg1);
 }
+
+export function UndoOrganize(arg1) {
+  return window['go']['main']['App']['UndoOrganize'](arg1);
+}
+
+export function UnfinishedDownloads() {
+  return window['go']['main']['App']['UnfinishedDownloads']();
+}
+
+export function WriteTags(arg1) {
+  return window['go']['main']['App']['WriteTags'](arg1);
+}
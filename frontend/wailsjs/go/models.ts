@@ -2,6 +2,10 @@ export namespace configs {
 	
 	export class DownloadConfig {
 	    path: string;
+	    threads: number;
+	    max_active: number;
+	    stream: string;
+	    auto_resume: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new DownloadConfig(source);
@@ -10,6 +14,99 @@ export namespace configs {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.path = source["path"];
+	        this.threads = source["threads"];
+	        this.max_active = source["max_active"];
+	        this.stream = source["stream"];
+	        this.auto_resume = source["auto_resume"];
+	    }
+	}
+
+	export class NcmConfig {
+	    crc_check: string;
+	    output_dir: string;
+	    name_template: string;
+	    conflict_policy: string;
+	    workers: number;
+	    tag: TagConfig;
+	    offline: boolean;
+	    cover_cache_dir: string;
+	    source_policy: string;
+	    watch: WatchConfig;
+	
+	    static createFrom(source: any = {}) {
+	        return new NcmConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.crc_check = source["crc_check"];
+	        this.output_dir = source["output_dir"];
+	        this.name_template = source["name_template"];
+	        this.conflict_policy = source["conflict_policy"];
+	        this.workers = source["workers"];
+	        this.tag = this.convertValues(source["tag"], TagConfig);
+	        this.offline = source["offline"];
+	        this.cover_cache_dir = source["cover_cache_dir"];
+	        this.source_policy = source["source_policy"];
+	        this.watch = this.convertValues(source["watch"], WatchConfig);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class TagConfig {
+	    overwrite: boolean;
+	    id3: {[key: string]: string};
+	    vorbis: {[key: string]: string};
+	
+	    static createFrom(source: any = {}) {
+	        return new TagConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.overwrite = source["overwrite"];
+	        this.id3 = source["id3"];
+	        this.vorbis = source["vorbis"];
+	    }
+	}
+
+	export class WatchConfig {
+	    enabled: boolean;
+	    dirs: string[];
+	    recursive: boolean;
+	    mode: string;
+	    interval: number;
+	    settle_time: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new WatchConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.dirs = source["dirs"];
+	        this.recursive = source["recursive"];
+	        this.mode = source["mode"];
+	        this.interval = source["interval"];
+	        this.settle_time = source["settle_time"];
 	    }
 	}
 
@@ -22,6 +119,13 @@ export namespace main {
 	    path: string;
 	    mod_time: string;
 	    size: string;
+	    title?: string;
+	    artists?: string[];
+	    album?: string;
+	    format?: string;
+	    bitrate?: number;
+	    duration?: number;
+	    cover?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new NcmFile(source);
@@ -33,6 +137,13 @@ export namespace main {
 	        this.path = source["path"];
 	        this.mod_time = source["mod_time"];
 	        this.size = source["size"];
+	        this.title = source["title"];
+	        this.artists = source["artists"];
+	        this.album = source["album"];
+	        this.format = source["format"];
+	        this.bitrate = source["bitrate"];
+	        this.duration = source["duration"];
+	        this.cover = source["cover"];
 	    }
 	}
 
@@ -46,9 +157,11 @@ export namespace tools {
 	    type: string;
 	    url: string;
 	    quality: string;
+	    stream: string;
 	    size: string;
 	    byte: number;
 	    percentage: number;
+	    streams: StreamInfo[];
 	
 	    static createFrom(source: any = {}) {
 	        return new ExtractLinkData(source);
@@ -61,9 +174,606 @@ export namespace tools {
 	        this.type = source["type"];
 	        this.url = source["url"];
 	        this.quality = source["quality"];
+	        this.stream = source["stream"];
 	        this.size = source["size"];
 	        this.byte = source["byte"];
 	        this.percentage = source["percentage"];
+	        this.streams = this.convertValues(source["streams"], StreamInfo);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class TransformResult {
+	    input: string;
+	    output: string;
+	    decryptor: string;
+	    format: string;
+	    meta_format: string;
+	    bytes: number;
+	    duration: number;
+	    error: string;
+	    warnings: string[];
+	    skipped: boolean;
+	    lyrics: boolean;
+	    source_policy: string;
+	    archive_id: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TransformResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.input = source["input"];
+	        this.output = source["output"];
+	        this.decryptor = source["decryptor"];
+	        this.format = source["format"];
+	        this.meta_format = source["meta_format"];
+	        this.bytes = source["bytes"];
+	        this.duration = source["duration"];
+	        this.error = source["error"];
+	        this.warnings = source["warnings"];
+	        this.skipped = source["skipped"];
+	        this.lyrics = source["lyrics"];
+	        this.source_policy = source["source_policy"];
+	        this.archive_id = source["archive_id"];
+	    }
+	}
+
+	export class TransformSummary {
+	    total: number;
+	    succeeded: number;
+	    failed: number;
+	    skipped: number;
+	    canceled: number;
+	    bytes: number;
+	    duration: number;
+	    results: TransformResult[];
+	    missing_lyrics: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new TransformSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.total = source["total"];
+	        this.succeeded = source["succeeded"];
+	        this.failed = source["failed"];
+	        this.skipped = source["skipped"];
+	        this.canceled = source["canceled"];
+	        this.bytes = source["bytes"];
+	        this.duration = source["duration"];
+	        this.results = this.convertValues(source["results"], TransformResult);
+	        this.missing_lyrics = source["missing_lyrics"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class ScanOptions {
+	    recursive: boolean;
+	    max_depth: number;
+	    include: string[];
+	    exclude: string[];
+	    follow_symlinks: boolean;
+	    skip_hidden: boolean;
+	    batch_size: number;
+	    inspect: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScanOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.recursive = source["recursive"];
+	        this.max_depth = source["max_depth"];
+	        this.include = source["include"];
+	        this.exclude = source["exclude"];
+	        this.follow_symlinks = source["follow_symlinks"];
+	        this.skip_hidden = source["skip_hidden"];
+	        this.batch_size = source["batch_size"];
+	        this.inspect = source["inspect"];
+	    }
+	}
+
+	export class NcmInfo {
+	    title: string;
+	    artists: string[];
+	    album: string;
+	    format: string;
+	    bitrate: number;
+	    duration: number;
+	    cover: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new NcmInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.artists = source["artists"];
+	        this.album = source["album"];
+	        this.format = source["format"];
+	        this.bitrate = source["bitrate"];
+	        this.duration = source["duration"];
+	        this.cover = source["cover"];
+	    }
+	}
+
+	export class ArchiveEntry {
+	    id: string;
+	    source: string;
+	    path: string;
+	    output: string;
+	    time: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ArchiveEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.source = source["source"];
+	        this.path = source["path"];
+	        this.output = source["output"];
+	        this.time = source["time"];
+	    }
+	}
+
+	export class AudioTag {
+	    title: string;
+	    artist: string;
+	    album_artist: string;
+	    album: string;
+	    track: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new AudioTag(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.artist = source["artist"];
+	        this.album_artist = source["album_artist"];
+	        this.album = source["album"];
+	        this.track = source["track"];
+	    }
+	}
+
+	export class OrganizeMove {
+	    source: string;
+	    target: string;
+	    tag: AudioTag;
+	    conflict: string;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new OrganizeMove(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.source = source["source"];
+	        this.target = source["target"];
+	        this.tag = this.convertValues(source["tag"], AudioTag);
+	        this.conflict = source["conflict"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class OrganizePlan {
+	    root: string;
+	    moves: OrganizeMove[];
+	    unchanged: number;
+	    conflicts: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new OrganizePlan(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.root = source["root"];
+	        this.moves = this.convertValues(source["moves"], OrganizeMove);
+	        this.unchanged = source["unchanged"];
+	        this.conflicts = source["conflicts"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class OrganizeResult {
+	    batch_id: string;
+	    moved: number;
+	    skipped: number;
+	    failed: OrganizeMove[];
+	
+	    static createFrom(source: any = {}) {
+	        return new OrganizeResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.batch_id = source["batch_id"];
+	        this.moved = source["moved"];
+	        this.skipped = source["skipped"];
+	        this.failed = this.convertValues(source["failed"], OrganizeMove);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class OrganizeBatchInfo {
+	    id: string;
+	    root: string;
+	    moved: number;
+	    time: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new OrganizeBatchInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.root = source["root"];
+	        this.moved = source["moved"];
+	        this.time = source["time"];
+	    }
+	}
+
+	export class TagCover {
+	    mime: string;
+	    size: number;
+	    thumbnail: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TagCover(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mime = source["mime"];
+	        this.size = source["size"];
+	        this.thumbnail = source["thumbnail"];
+	    }
+	}
+
+	export class TagEdit {
+	    op: string;
+	    field: string;
+	    values: string[];
+	    find: string;
+	    replace: string;
+	    regexp: boolean;
+	    start: number;
+	    with_total: boolean;
+	    path: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TagEdit(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.op = source["op"];
+	        this.field = source["field"];
+	        this.values = source["values"];
+	        this.find = source["find"];
+	        this.replace = source["replace"];
+	        this.regexp = source["regexp"];
+	        this.start = source["start"];
+	        this.with_total = source["with_total"];
+	        this.path = source["path"];
+	    }
+	}
+
+	export class TagFile {
+	    path: string;
+	    format: string;
+	    size: number;
+	    mod_time: number;
+	    fields: {[key: string]: string[]};
+	    extra: {[key: string]: string[]};
+	    cover: TagCover;
+	    cover_path: string;
+	    remove_cover: boolean;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TagFile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.format = source["format"];
+	        this.size = source["size"];
+	        this.mod_time = source["mod_time"];
+	        this.fields = source["fields"];
+	        this.extra = source["extra"];
+	        this.cover = this.convertValues(source["cover"], TagCover);
+	        this.cover_path = source["cover_path"];
+	        this.remove_cover = source["remove_cover"];
+	        this.error = source["error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class DownloadHistoryEntry {
+	    id: string;
+	    url: string;
+	    site: string;
+	    title: string;
+	    quality: string;
+	    size: number;
+	    output: string;
+	    start_time: number;
+	    end_time: number;
+	    state: string;
+	    error: string;
+	    deleted?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new DownloadHistoryEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.url = source["url"];
+	        this.site = source["site"];
+	        this.title = source["title"];
+	        this.quality = source["quality"];
+	        this.size = source["size"];
+	        this.output = source["output"];
+	        this.start_time = source["start_time"];
+	        this.end_time = source["end_time"];
+	        this.state = source["state"];
+	        this.error = source["error"];
+	        this.deleted = source["deleted"];
+	    }
+	}
+
+	export class DownloadHistoryPage {
+	    total: number;
+	    entries: DownloadHistoryEntry[];
+	
+	    static createFrom(source: any = {}) {
+	        return new DownloadHistoryPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.total = source["total"];
+	        this.entries = this.convertValues(source["entries"], DownloadHistoryEntry);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class DownloadHistoryQuery {
+	    title: string;
+	    site: string;
+	    state: string;
+	    since: number;
+	    until: number;
+	    page: number;
+	    page_size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DownloadHistoryQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.site = source["site"];
+	        this.state = source["state"];
+	        this.since = source["since"];
+	        this.until = source["until"];
+	        this.page = source["page"];
+	        this.page_size = source["page_size"];
+	    }
+	}
+
+	export class DownloadTask {
+	    id: string;
+	    url: string;
+	    title: string;
+	    stream: string;
+	    quality: string;
+	    size: number;
+	    output: string;
+	    parts: string[];
+	    add_time: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DownloadTask(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.url = source["url"];
+	        this.title = source["title"];
+	        this.stream = source["stream"];
+	        this.quality = source["quality"];
+	        this.size = source["size"];
+	        this.output = source["output"];
+	        this.parts = source["parts"];
+	        this.add_time = source["add_time"];
+	    }
+	}
+
+	export class DownloadQueueItem {
+	    id: string;
+	    title: string;
+	    quality: string;
+	    size: string;
+	    priority: number;
+	    state: string;
+	    position: number;
+	    add_time: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DownloadQueueItem(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.quality = source["quality"];
+	        this.size = source["size"];
+	        this.priority = source["priority"];
+	        this.state = source["state"];
+	        this.position = source["position"];
+	        this.add_time = source["add_time"];
+	    }
+	}
+
+	export class StreamInfo {
+	    id: string;
+	    quality: string;
+	    size: string;
+	    byte: number;
+	    ext: string;
+	    need_mux: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new StreamInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.quality = source["quality"];
+	        this.size = source["size"];
+	        this.byte = source["byte"];
+	        this.ext = source["ext"];
+	        this.need_mux = source["need_mux"];
 	    }
 	}
 
@@ -27,7 +27,7 @@ func Error(info string) {
 }
 
 func Errorf(format string, args ...interface{}) {
-	log.Errorf(format, args)
+	log.Errorf(format, args...)
 }
 
 type FileHook struct {